@@ -12,7 +12,10 @@ import (
 func main() {
 	app := application.NewApplication()
 
-	shutDownFunc, err := server.Run(app)
+	// The server submits new operations to the orchestrator
+	orc := orchestrator.New(app)
+
+	shutDownFunc, err := server.Run(app, orc)
 	if err != nil {
 		app.Logger.Fatal(err.Error())
 	}
@@ -21,7 +24,6 @@ func main() {
 	defer stop()
 
 	// Starting orchestrator and workers
-	orc := orchestrator.New(app)
 	go orc.Run()
 
 	app.Logger.Println("Server started at localhost:8081")
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math-calc/internal/application"
+	"math-calc/internal/orchestrator"
+	"net/http"
+	"slices"
+	"sort"
+)
+
+type queueOutput struct {
+	// Queued is the total number of operations waiting for a worker.
+	Queued int               `json:"queued"`
+	Users  []queueUserOutput `json:"users"`
+}
+
+type queueUserOutput struct {
+	Id       int    `json:"id"`
+	Username string `json:"username"`
+	Weight   int    `json:"weight"`
+	Queued   int    `json:"queued"`
+}
+
+type cacheOutput struct {
+	// Hits is the number of operations completed from the result cache.
+	Hits uint64 `json:"hits"`
+	// Misses is the number of operations which had to be calculated by workers.
+	Misses uint64 `json:"misses"`
+}
+
+// authenticateAdmin checks that the request is made by one of config.Config.Admins and returns the user ID.
+// Otherwise, it writes 401 or 403 response and returns false.
+func authenticateAdmin(w http.ResponseWriter, r *http.Request) (int, bool) {
+	userId, ok := authenticate(w, r)
+	if !ok {
+		return 0, false
+	}
+
+	app := r.Context().Value("app").(*application.Application)
+	user, err := app.Database.GetUserByID(userId)
+	if err != nil || !slices.Contains(app.Config.Admins, user.Username) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprintln(w, "only administrators are allowed")
+		return 0, false
+	}
+	return userId, true
+}
+
+// adminQueue handles /api/v1/admin/queue. It returns the numbers of operations users have waiting for workers.
+func adminQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := authenticateAdmin(w, r); !ok {
+		return
+	}
+
+	app := r.Context().Value("app").(*application.Application)
+	orc := r.Context().Value("orchestrator").(*orchestrator.Orchestrator)
+
+	output := queueOutput{Users: []queueUserOutput{}}
+	for id, queued := range orc.QueueDepths() {
+		user := queueUserOutput{Id: id, Weight: orc.Weight(id), Queued: queued}
+		if u, err := app.Database.GetUserByID(id); err == nil {
+			user.Username = u.Username
+		}
+		output.Users = append(output.Users, user)
+		output.Queued += queued
+	}
+	sort.Slice(output.Users, func(i, j int) bool {
+		return output.Users[i].Id < output.Users[j].Id
+	})
+
+	data, err := json.MarshalIndent(output, "", "    ")
+	if err != nil {
+		panic(err)
+	}
+	w.Write(data)
+}
+
+// adminCache handles /api/v1/admin/cache. It returns the numbers of hits and misses of the result cache.
+func adminCache(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if _, ok := authenticateAdmin(w, r); !ok {
+		return
+	}
+
+	orc := r.Context().Value("orchestrator").(*orchestrator.Orchestrator)
+
+	output := cacheOutput{}
+	output.Hits, output.Misses = orc.CacheStats()
+
+	data, err := json.MarshalIndent(output, "", "    ")
+	if err != nil {
+		panic(err)
+	}
+	w.Write(data)
+}
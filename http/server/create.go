@@ -2,26 +2,57 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"go/ast"
-	"go/parser"
-	"go/token"
 	"io"
 	"math-calc/internal/application"
+	"math-calc/internal/config"
+	"math-calc/internal/db"
+	"math-calc/internal/decimal"
+	"math-calc/internal/expr"
 	"math-calc/internal/operation"
+	"math-calc/internal/orchestrator"
 	"net/http"
-	"strconv"
+	"sort"
 	"strings"
 )
 
 var usedIdempotentTokens = make(map[string]bool)
 
+// maxRequestSize limits bodies of requests with expressions, which are parsed and planned in memory.
+const maxRequestSize = 1 << 20
+
 type createInput struct {
 	Expression string `json:"expression"`
+	// Variables bind names used in the expression. They take precedence over built-in constants.
+	Variables map[string]float64 `json:"variables"`
+	// Mode is the kind of numbers used for calculation, see operation.Mode. Defaults to float.
+	Mode string `json:"mode"`
+	// Precision is the number of significant digits in decimal mode.
+	Precision int `json:"precision"`
+	// Rounding is the rounding mode in decimal mode, see decimal.RoundingMode.
+	Rounding string `json:"rounding"`
+	// Optimize enables folding of constants and identities like x*1 before the expression is calculated.
+	Optimize bool `json:"optimize"`
+	// Reassociate enables rewriting of long chains of additions and multiplications into balanced trees,
+	// so that more operations are calculated in parallel. It may change results in float, decimal and complex modes.
+	Reassociate bool `json:"reassociate"`
+	// Priority orders calculation of expressions competing for workers, higher first. Defaults to 0.
+	Priority int `json:"priority"`
 }
 
 type createOutput struct {
 	Id operation.ID `json:"id"`
+	// Depth is set when the expression was optimized.
+	Depth *depthOutput `json:"depth,omitempty"`
+	// EstimatedTime is the number of seconds the calculation is expected to take if there are enough workers.
+	EstimatedTime int `json:"estimated_time"`
+}
+
+// depthOutput is the length of the longest chain of operations before and after optimization.
+type depthOutput struct {
+	Before int `json:"before"`
+	After  int `json:"after"`
 }
 
 func createExpression(w http.ResponseWriter, r *http.Request) {
@@ -31,17 +62,8 @@ func createExpression(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bearerToken := r.Header.Get("Authorization")
-	if bearerToken == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprintln(w, "missing Authorization header")
-		return
-	}
-	bearerToken, _ = strings.CutPrefix(bearerToken, "Bearer ")
-	userId, err := checkJWT(bearerToken)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprintln(w, "invalid token")
+	userId, ok := authenticate(w, r)
+	if !ok {
 		return
 	}
 
@@ -55,8 +77,15 @@ func createExpression(w http.ResponseWriter, r *http.Request) {
 		usedIdempotentTokens[idempToken] = true
 	}
 
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
 	defer r.Body.Close()
 	body, err := io.ReadAll(r.Body)
+	var sizeErr *http.MaxBytesError
+	if errors.As(err, &sizeErr) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		fmt.Fprintf(w, "request body is larger than %d bytes", sizeErr.Limit)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		fmt.Fprintf(w, "failed to read request body: %s", err)
@@ -71,114 +100,605 @@ func createExpression(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	settings, err := input.settings()
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, err)
+		return
+	}
+
 	app := r.Context().Value("app").(*application.Application)
 
+	limits, err := app.Database.GetLimits(userId, app.Config.Limits)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to get limits: %s", err)
+		return
+	}
+
 	app.Database.UpdatingMutex.Lock()
 
-	opId, err := parseExpression(input.Expression, app, userId)
+	u := newUnparser(app, userId, settings, input.Variables)
+	u.limits = limits
+	u.optimize = input.Optimize
+	u.reassociate = input.Reassociate
+	u.priority = input.Priority
+	opId, err := u.parseExpression(input.Expression)
 	op, _ := app.Database.Get(opId)
 	op.Expression = input.Expression
+	op.Variables = u.usedVariables
 	app.Database.Update(op)
 
 	app.Database.UpdatingMutex.Unlock()
 
+	var limitErr *limitError
+	if errors.As(err, &limitErr) {
+		writeLimitError(w, limitErr)
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		fmt.Fprintf(w, "failed to parse expression: %s", err)
 		return
 	}
+	u.submit(r)
 
 	w.WriteHeader(http.StatusCreated)
-	data, err := json.Marshal(createOutput{Id: opId})
+	// Operations of the longest chain are calculated one after another
+	output := createOutput{Id: opId, EstimatedTime: u.graph.After * app.Config.OperationCalculationTime}
+	if u.optimize || u.reassociate {
+		output.Depth = &u.graph
+	}
+	data, err := json.Marshal(output)
 	if err != nil {
 		panic(err)
 	}
 	w.Write(data)
 }
 
-func parseExpression(expression string, app *application.Application, ownerId int) (operation.ID, error) {
-	expr, err := parser.ParseExpr(expression)
+// submit passes the stored operations to the orchestrator, so that it doesn't have to find them in the database.
+func (u *unparser) submit(r *http.Request) {
+	orc := r.Context().Value("orchestrator").(*orchestrator.Orchestrator)
+	orc.Submit(u.created...)
+}
+
+// settings returns the arithmetic settings of the expression as an operation template.
+func (input createInput) settings() (operation.Operation, error) {
+	mode, err := operation.ParseMode(input.Mode)
 	if err != nil {
-		return 0, fmt.Errorf("failed to parse expression: %w", err)
+		return operation.Operation{}, err
+	}
+	if mode == operation.ModeInteger {
+		if input.Precision != 0 {
+			return operation.Operation{}, fmt.Errorf("precision is supported only in decimal mode")
+		}
+		// Without rounding, division has to be exact
+		if input.Rounding == "" {
+			return operation.Operation{Mode: mode}, nil
+		}
+		rounding, err := decimal.ParseRoundingMode(input.Rounding)
+		if err != nil {
+			return operation.Operation{}, err
+		}
+		return operation.Operation{Mode: mode, Rounding: rounding}, nil
+	}
+	if mode != operation.ModeDecimal {
+		if input.Precision != 0 || input.Rounding != "" {
+			return operation.Operation{}, fmt.Errorf("precision and rounding are supported only in decimal and integer modes")
+		}
+		return operation.Operation{Mode: mode}, nil
+	}
+
+	precision := input.Precision
+	if precision == 0 {
+		precision = operation.DefaultPrecision
+	}
+	if precision < 1 || precision > operation.MaxPrecision {
+		return operation.Operation{}, fmt.Errorf("precision must be from 1 to %d", operation.MaxPrecision)
 	}
 
-	result, err := unparseTree(expr, app, ownerId)
+	rounding, err := decimal.ParseRoundingMode(input.Rounding)
 	if err != nil {
-		return 0, fmt.Errorf("failed to unparse expression: %w", err)
+		return operation.Operation{}, err
+	}
+	return operation.Operation{Mode: mode, Precision: precision, Rounding: rounding}, nil
+}
+
+// unparser converts an expression tree into operations owned by a single user.
+type unparser struct {
+	app     *application.Application
+	ownerId int
+	// settings holds Mode, Precision and Rounding shared by all operations of the expression.
+	settings  operation.Operation
+	variables map[string]float64
+	// savedVariables are the variables the user has stored with /api/v1/variables/.
+	savedVariables map[string]db.Variable
+	// functions are the functions the user has defined with /api/v1/functions/.
+	functions map[string]db.Function
+
+	// usedVariables are the variables which were substituted into the expression.
+	usedVariables map[string]float64
+	// branches is the stack of conditional branches being unparsed, innermost last.
+	// Operations of branches are deferred, they wait for the condition.
+	branches []int
+	// lastBranch is the number of the last conditional branch.
+	lastBranch int
+	// operations maps keys of planned operations to their ids, so that identical subexpressions
+	// are calculated once. Keys are prefixed with the branch the operation belongs to, see sharedKey.
+	operations map[string]operation.ID
+	// plan holds the operations of the expression until they are stored, see store.
+	plan []plannedOperation
+	// params are the arguments of the user-defined function which body is being unparsed.
+	// Function bodies see only their parameters and constants. It is nil outside of functions.
+	params map[string]unparseResult
+	// depth is the number of nested user-defined function calls being expanded.
+	depth int
+	// expanded is the number of nodes of function bodies unparsed so far, see maxExpandedNodes.
+	expanded int
+
+	// optimize and reassociate enable passes of the optimizer, see fold and balanceChains.
+	optimize    bool
+	reassociate bool
+	// graph is the depth of the operation graph before and after optimization.
+	graph depthOutput
+	// priority is the priority of all operations of the expression.
+	priority int
+	// limits are the quotas of the owner checked while operations are planned and before they are stored,
+	// see checkSize and checkLimits.
+	limits config.Limits
+	// created are the stored operations which are ready to be scheduled, see submit.
+	created []operation.ID
+}
+
+const (
+	// maxFunctionDepth limits nesting of user-defined function calls. It also stops indirect recursion.
+	maxFunctionDepth = 16
+	// maxExpandedNodes limits the total size of user-defined function bodies expanded for an expression.
+	// A body may call other functions several times, so their size grows exponentially with nesting.
+	// Every node produces at most one operation, so this also limits operations produced by functions.
+	maxExpandedNodes = 100000
+)
+
+func newUnparser(app *application.Application, ownerId int, settings operation.Operation, variables map[string]float64) *unparser {
+	return &unparser{
+		app:           app,
+		ownerId:       ownerId,
+		settings:      settings,
+		variables:     variables,
+		usedVariables: make(map[string]float64),
+		operations:    make(map[string]operation.ID),
+	}
+}
+
+func (u *unparser) parseExpression(expression string) (operation.ID, error) {
+	result, err := u.unparse(expression)
+	if err != nil {
+		return 0, err
 	}
 
 	if result.OperationID == 0 {
 		return 0, fmt.Errorf("the expression does not contain any operations")
 	}
 
-	return result.OperationID, nil
+	return u.schedule(result.OperationID)
+}
+
+// unparse plans the operations of the expression and returns its result.
+// The result is a literal if the expression doesn't need any calculation.
+func (u *unparser) unparse(expression string) (unparseResult, error) {
+	tree, err := expr.Parse(expression)
+	if err != nil {
+		return unparseResultEmpty, err
+	}
+
+	u.savedVariables, err = u.app.Database.GetVariables(u.ownerId)
+	if err != nil {
+		return unparseResultEmpty, fmt.Errorf("failed to get saved variables: %w", err)
+	}
+	u.functions, err = u.app.Database.GetFunctions(u.ownerId)
+	if err != nil {
+		return unparseResultEmpty, fmt.Errorf("failed to get functions: %w", err)
+	}
+
+	// Checking names before creating any operation, so nothing is left behind on error
+	err = u.checkNames(tree)
+	if err != nil {
+		return unparseResultEmpty, err
+	}
+
+	result, err := u.unparseTree(tree)
+	if err != nil {
+		return unparseResultEmpty, fmt.Errorf("failed to unparse expression: %w", err)
+	}
+	return result, nil
+}
+
+// schedule optimizes the planned operations root depends on, if requested, checks quotas of the owner
+// and stores them, so that the orchestrator picks them up. It returns the id of the stored root.
+func (u *unparser) schedule(root operation.ID) (operation.ID, error) {
+	u.graph.Before = u.graphDepth(root)
+	if u.optimize {
+		root = u.fold(root)
+	}
+	if u.reassociate {
+		u.balanceChains(root)
+	}
+	u.graph.After = u.graphDepth(root)
+
+	err := u.checkLimits(root)
+	if err != nil {
+		return 0, err
+	}
+	return u.store(root)
+}
+
+// checkNames returns an error listing all names in the tree that are neither variables nor constants.
+func (u *unparser) checkNames(tree expr.Node) error {
+	var first *expr.Ident
+	var unbound []string
+	seen := make(map[string]bool)
+
+	expr.Inspect(tree, func(node expr.Node) bool {
+		ident, ok := node.(*expr.Ident)
+		if !ok || seen[ident.Name] {
+			return true
+		}
+		seen[ident.Name] = true
+
+		if !u.isBound(ident.Name) {
+			if first == nil {
+				first = ident
+			}
+			unbound = append(unbound, ident.Name)
+		}
+		return true
+	})
+
+	if len(unbound) == 0 {
+		return nil
+	}
+	sort.Strings(unbound)
+	return expr.Errorf(first, "unbound identifiers: %s", strings.Join(unbound, ", "))
 }
 
-type unparseResult struct {
-	OperationID operation.ID
-	Value       float64
+func (u *unparser) isBound(name string) bool {
+	_, isVariable := u.variables[name]
+	_, isSaved := u.savedVariables[name]
+	_, isConstant := expr.Constants[name]
+	isImaginaryUnit := name == imaginaryUnit && u.settings.Mode == operation.ModeComplex
+	return isVariable || isSaved || isConstant || isImaginaryUnit
 }
 
+// imaginaryUnit is the name of the imaginary unit in complex mode.
+const imaginaryUnit = "i"
+
+// lookupName resolves a name into a value or an operation which result has to be awaited.
+// Request variables take precedence over saved variables, which take precedence over constants.
+func (u *unparser) lookupName(ident *expr.Ident) (unparseResult, error) {
+	if u.params != nil {
+		if value, ok := u.params[ident.Name]; ok {
+			return value, nil
+		}
+		return u.lookupConstant(ident)
+	}
+
+	if value, ok := u.variables[ident.Name]; ok {
+		u.usedVariables[ident.Name] = value
+		return u.fromFloat(ident, value)
+	}
+
+	if saved, ok := u.savedVariables[ident.Name]; ok {
+		if saved.OperationID == 0 {
+			u.usedVariables[ident.Name] = saved.Value
+			return u.fromFloat(ident, saved.Value)
+		}
+
+		op, err := u.app.Database.Get(saved.OperationID)
+		if err != nil {
+			return unparseResultEmpty, expr.Errorf(ident, "variable %s is bound to expression %d which doesn't exist", ident.Name, saved.OperationID)
+		}
+		switch op.State {
+		case operation.StateDone:
+			result, err := u.settings.Convert(op.Mode, op.ResultOperand())
+			if err != nil {
+				return unparseResultEmpty, expr.Errorf(ident, "variable %s is bound to expression %d calculated in %s mode, its result can't be used in %s mode: %s",
+					ident.Name, op.Id, op.Mode, u.settings.Mode, err)
+			}
+			u.usedVariables[ident.Name] = op.Result
+			return result, nil
+		case operation.StateError:
+			return unparseResultEmpty, expr.Errorf(ident, "variable %s is bound to expression %d which has failed: %s", ident.Name, op.Id, op.Error)
+		case operation.StateSkipped:
+			return unparseResultEmpty, expr.Errorf(ident, "variable %s is bound to operation %d which was skipped", ident.Name, op.Id)
+		}
+		// The orchestrator will substitute the result once the expression is done
+		return unparseResult{OperationID: op.Id}, nil
+	}
+
+	return u.lookupConstant(ident)
+}
+
+// lookupConstant resolves a name of a constant. In complex mode, i is the imaginary unit.
+func (u *unparser) lookupConstant(ident *expr.Ident) (unparseResult, error) {
+	if value, ok := expr.Constants[ident.Name]; ok {
+		switch u.settings.Mode {
+		case operation.ModeFloat:
+			return unparseResult{Value: value}, nil
+		case operation.ModeComplex:
+			return operation.ComplexOperand(complex(value, 0)), nil
+		}
+		return unparseResultEmpty, expr.Errorf(ident, "constant %s is irrational and can't be used in %s mode", ident.Name, u.settings.Mode)
+	}
+	if ident.Name == imaginaryUnit && u.settings.Mode == operation.ModeComplex {
+		return operation.ComplexOperand(1i), nil
+	}
+	return unparseResultEmpty, expr.Errorf(ident, "unbound identifier %s", ident.Name)
+}
+
+func (u *unparser) fromFloat(ident *expr.Ident, value float64) (unparseResult, error) {
+	result, err := operation.FromFloat(u.settings.Mode, value)
+	if err != nil {
+		return unparseResultEmpty, expr.Errorf(ident, "variable %s: %s", ident.Name, err)
+	}
+	return result, nil
+}
+
+// binaryOperators maps binary operators of expressions to operators of operations.
+var binaryOperators = map[expr.Kind]operation.Operator{
+	expr.Add:      operation.Addition,
+	expr.Sub:      operation.Subtraction,
+	expr.Mul:      operation.Multiply,
+	expr.Quo:      operation.Division,
+	expr.FloorQuo: operation.FloorDivision,
+	expr.Rem:      operation.Modulo,
+	expr.Pow:      operation.Power,
+	expr.Eql:      operation.Equal,
+	expr.Neq:      operation.NotEqual,
+	expr.Lss:      operation.Less,
+	expr.Leq:      operation.LessEqual,
+	expr.Gtr:      operation.Greater,
+	expr.Geq:      operation.GreaterEqual,
+	expr.And:      operation.And,
+	expr.Or:       operation.Or,
+	expr.Dot:      operation.Dot,
+}
+
+// unparseResult is either a literal value or an operation which result is awaited.
+type unparseResult = operation.Operand
+
 var unparseResultEmpty = unparseResult{}
 
-func unparseTree(expr ast.Expr, app *application.Application, ownerId int) (unparseResult, error) {
-	switch e := expr.(type) {
-	case *ast.BinaryExpr:
-		left, err := unparseTree(e.X, app, ownerId)
+func (u *unparser) unparseTree(node expr.Node) (unparseResult, error) {
+	if u.depth > 0 {
+		u.expanded++
+		if u.expanded > maxExpandedNodes {
+			return unparseResultEmpty, errTooLargeExpansion
+		}
+	}
+
+	switch e := node.(type) {
+	case *expr.BinaryExpr:
+		left, err := u.unparseTree(e.X)
 		if err != nil {
 			return unparseResultEmpty, err
 		}
 
-		right, err := unparseTree(e.Y, app, ownerId)
+		right, err := u.unparseTree(e.Y)
 		if err != nil {
 			return unparseResultEmpty, err
 		}
 
-		op := operation.Operation{}
-		op.OwnerID = ownerId
+		op, ok := binaryOperators[e.Op]
+		if !ok {
+			return unparseResultEmpty, expr.Errorf(e, "unsupported operation: %s", e.Op)
+		}
 
-		if left.OperationID != 0 {
-			op.LeftOperationID = left.OperationID
-		} else {
-			op.Left = left.Value
+		return u.createOperation(op, left, right)
+	case *expr.UnaryExpr:
+		x, err := u.unparseTree(e.X)
+		if err != nil {
+			return unparseResultEmpty, err
 		}
 
-		if right.OperationID != 0 {
-			op.RightOperationID = right.OperationID
-		} else {
-			op.Right = right.Value
+		if e.Op == expr.Add {
+			return x, nil
+		}
+		if e.Op == expr.Not {
+			return u.createOperation(operation.Not, x)
+		}
+		if e.Op != expr.Sub {
+			return unparseResultEmpty, expr.Errorf(e, "unsupported operation: %s", e.Op)
 		}
 
-		switch e.Op {
-		case token.ADD:
-			op.Op = operation.Addition
-		case token.SUB:
-			op.Op = operation.Subtraction
-		case token.MUL:
-			op.Op = operation.Multiply
-		case token.QUO:
-			op.Op = operation.Division
-		default:
-			return unparseResultEmpty, fmt.Errorf("unsupported operation: %s", e.Op)
+		// Negating a constant number doesn't need a worker
+		if x.OperationID == 0 && !x.IsArray() {
+			negated, err := operation.Negate(u.settings.Mode, x)
+			if err != nil {
+				return unparseResultEmpty, expr.Errorf(e, "%s", err)
+			}
+			return negated, nil
 		}
 
-		opID, err := app.Database.Create(op)
+		return u.createOperation(operation.Negation, x)
+	case *expr.CallExpr:
+		if e.Fun.Name == string(operation.Conditional) {
+			return u.unparseConditional(e)
+		}
 
-		if err != nil {
-			return unparseResultEmpty, err
+		fn, ok := operation.LookupFunction(e.Fun.Name)
+		if !ok {
+			if f, ok := u.functions[e.Fun.Name]; ok {
+				return u.expandFunction(e, f)
+			}
+			return unparseResultEmpty, expr.Errorf(e.Fun, "unknown function %s", e.Fun.Name)
+		}
+		if !fn.AcceptsArgs(len(e.Args)) {
+			return unparseResultEmpty, expr.Errorf(e, "function %s expects %s, got %d", e.Fun.Name, describeArity(fn), len(e.Args))
 		}
 
-		return unparseResult{OperationID: opID}, nil
-	case *ast.BasicLit:
-		value, err := strconv.ParseFloat(e.Value, 64)
+		args := make([]unparseResult, len(e.Args))
+		for i, arg := range e.Args {
+			var err error
+			args[i], err = u.unparseTree(arg)
+			if err != nil {
+				return unparseResultEmpty, err
+			}
+		}
+
+		return u.createOperation(fn.Name, args...)
+	case *expr.Ident:
+		return u.lookupName(e)
+	case *expr.NumberLit:
+		value, err := operation.Literal(u.settings.Mode, e.Raw)
 		if err != nil {
-			return unparseResultEmpty, err
+			return unparseResultEmpty, expr.Errorf(e, "%s", err)
+		}
+		return value, nil
+	case *expr.ParenExpr:
+		return u.unparseTree(e.X)
+	case *expr.ListExpr:
+		elems := make([]unparseResult, len(e.Elems))
+		literals := true
+		for i, elem := range e.Elems {
+			var err error
+			elems[i], err = u.unparseTree(elem)
+			if err != nil {
+				return unparseResultEmpty, err
+			}
+			literals = literals && elems[i].OperationID == 0
 		}
 
-		return unparseResult{Value: value}, nil
-	case *ast.ParenExpr:
-		return unparseTree(e.X, app, ownerId)
+		// Arrays of literals don't need a worker
+		if literals {
+			array, err := operation.Pack(u.settings.Mode, elems)
+			if err != nil {
+				return unparseResultEmpty, expr.Errorf(e, "%s", err)
+			}
+			return array, nil
+		}
+		return u.createOperation(operation.PackArray, elems...)
 	default:
 		return unparseResultEmpty, fmt.Errorf("unsupported expression type: %T", e)
 	}
 }
+
+// expandFunction unparses the body of a user-defined function with its parameters bound to the arguments,
+// so that every step of the function is calculated by workers as usual.
+func (u *unparser) expandFunction(e *expr.CallExpr, f db.Function) (unparseResult, error) {
+	def, err := expr.ParseDefinition(f.Definition)
+	if err != nil {
+		return unparseResultEmpty, expr.Errorf(e.Fun, "function %s is malformed: %s", f.Name, err)
+	}
+	if len(e.Args) != len(def.Params) {
+		return unparseResultEmpty, expr.Errorf(e, "function %s expects %d argument(s), got %d", f.Name, len(def.Params), len(e.Args))
+	}
+	if u.depth >= maxFunctionDepth {
+		return unparseResultEmpty, expr.Errorf(e.Fun, "calls of function %s are nested too deeply, the limit is %d", f.Name, maxFunctionDepth)
+	}
+
+	// Arguments are unparsed in the scope of the caller
+	params := make(map[string]unparseResult, len(def.Params))
+	for i, arg := range e.Args {
+		params[def.Params[i].Name], err = u.unparseTree(arg)
+		if err != nil {
+			return unparseResultEmpty, err
+		}
+	}
+
+	outer := u.params
+	u.params = params
+	u.depth++
+	defer func() {
+		u.params = outer
+		u.depth--
+	}()
+
+	result, err := u.unparseTree(def.Body)
+	if err != nil {
+		err = inFunction(f.Name, err)
+		// Only the outermost call is a part of the expression
+		if u.depth == 1 {
+			err = atCall(e, err)
+		}
+		return unparseResultEmpty, err
+	}
+	return result, nil
+}
+
+// unparseConditional creates an if(cond, then, else) operation. Operations of both branches are deferred,
+// so that only the chosen one is calculated.
+func (u *unparser) unparseConditional(e *expr.CallExpr) (unparseResult, error) {
+	if len(e.Args) != 3 {
+		return unparseResultEmpty, expr.Errorf(e, "function if expects 3 argument(s), got %d", len(e.Args))
+	}
+
+	cond, err := u.unparseTree(e.Args[0])
+	if err != nil {
+		return unparseResultEmpty, err
+	}
+
+	then, err := u.unparseBranch(e.Args[1])
+	if err != nil {
+		return unparseResultEmpty, err
+	}
+	otherwise, err := u.unparseBranch(e.Args[2])
+	if err != nil {
+		return unparseResultEmpty, err
+	}
+
+	return u.createOperation(operation.Conditional, cond, then, otherwise)
+}
+
+// unparseBranch unparses a branch of a conditional, creating its operations deferred.
+func (u *unparser) unparseBranch(node expr.Node) (unparseResult, error) {
+	u.lastBranch++
+	u.branches = append(u.branches, u.lastBranch)
+	defer func() { u.branches = u.branches[:len(u.branches)-1] }()
+
+	return u.unparseTree(node)
+}
+
+// createOperation plans an operation applying op to the operands. It is stored later, see store.
+// If an identical operation has been planned already, it is reused instead.
+// Operations are shared only within the same conditional branch and the branches enclosing it,
+// so an operation of a branch is never calculated unless the branch is chosen.
+func (u *unparser) createOperation(op operation.Operator, operands ...unparseResult) (unparseResult, error) {
+	key := operation.Key(op, operands)
+	scopes := append([]int{0}, u.branches...)
+	if id, ok := findShared(u.operations, scopes, key); ok {
+		return unparseResult{OperationID: id}, nil
+	}
+
+	depth := u.plannedDepth(op, operands)
+	if err := u.checkSize(len(u.plan)+1, depth); err != nil {
+		return unparseResultEmpty, err
+	}
+
+	o := operation.Operation{
+		OwnerID:   u.ownerId,
+		Op:        op,
+		Mode:      u.settings.Mode,
+		Precision: u.settings.Precision,
+		Rounding:  u.settings.Rounding,
+		Priority:  u.priority,
+		Operands:  operands,
+	}
+	if len(u.branches) > 0 {
+		o.State = operation.StateDeferred
+	}
+
+	id := placeholderID(len(u.plan))
+	u.plan = append(u.plan, plannedOperation{Operation: o, scopes: scopes, depth: depth})
+	u.operations[sharedKey(scopes[len(scopes)-1], key)] = id
+	return unparseResult{OperationID: id}, nil
+}
+
+func describeArity(fn operation.Function) string {
+	switch {
+	case fn.MaxArgs == -1:
+		return fmt.Sprintf("at least %d argument(s)", fn.MinArgs)
+	case fn.MinArgs == fn.MaxArgs:
+		return fmt.Sprintf("%d argument(s)", fn.MinArgs)
+	}
+	return fmt.Sprintf("from %d to %d arguments", fn.MinArgs, fn.MaxArgs)
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math-calc/internal/application"
+	"math-calc/internal/db"
+	"math-calc/internal/expr"
+	"math-calc/internal/operation"
+	"net/http"
+)
+
+type deriveInput struct {
+	Expression string `json:"expression"`
+	// Variable is the name the expression is differentiated with respect to.
+	Variable string `json:"variable"`
+	// At binds names of the derivative like variables of createExpression.
+	// If it is set, the derivative is calculated at this point in float mode.
+	At map[string]float64 `json:"at"`
+}
+
+type deriveOutput struct {
+	Derivative string `json:"derivative"`
+	// Id is the expression calculating the derivative at the point.
+	Id operation.ID `json:"id,omitempty"`
+	// EstimatedTime is the number of seconds the calculation is expected to take, like in createOutput.
+	// It is set together with Id.
+	EstimatedTime *int `json:"estimated_time,omitempty"`
+	// Value is the derivative at the point if it doesn't need any calculation, e.g. for linear expressions.
+	Value *float64 `json:"value,omitempty"`
+}
+
+// derive handles /api/v1/derive. It returns the derivative of the expression
+// and, if a point is given, schedules its calculation like createExpression.
+func derive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		fmt.Fprintf(w, "only POST requests are allowed")
+		return
+	}
+
+	userId, ok := authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	var sizeErr *http.MaxBytesError
+	if errors.As(err, &sizeErr) {
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		fmt.Fprintf(w, "request body is larger than %d bytes", sizeErr.Limit)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to read request body: %s", err)
+		return
+	}
+
+	input := deriveInput{}
+	err = json.Unmarshal(body, &input)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "failed to unparse json: %s", err)
+		return
+	}
+
+	err = validateVariable(input.Variable)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, err)
+		return
+	}
+
+	tree, err := expr.Parse(input.Expression)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "failed to parse expression: %s", err)
+		return
+	}
+
+	app := r.Context().Value("app").(*application.Application)
+
+	funcs, err := app.Database.GetFunctions(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to get functions: %s", err)
+		return
+	}
+
+	var expanded int
+	tree, err = expandFunctions(tree, funcs, 0, &expanded)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "failed to parse expression: %s", err)
+		return
+	}
+
+	derivative, err := expr.Derive(tree, input.Variable)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "failed to derive expression: %s", err)
+		return
+	}
+	output := deriveOutput{Derivative: expr.Format(derivative)}
+
+	if input.At != nil {
+		limits, err := app.Database.GetLimits(userId, app.Config.Limits)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprintf(w, "failed to get limits: %s", err)
+			return
+		}
+
+		app.Database.UpdatingMutex.Lock()
+
+		u := newUnparser(app, userId, operation.Operation{Mode: operation.ModeFloat}, input.At)
+		u.limits = limits
+		var result unparseResult
+		result, err = u.unparse(output.Derivative)
+		if err == nil && result.OperationID == 0 {
+			output.Value = &result.Value
+		} else if err == nil {
+			output.Id, err = u.schedule(result.OperationID)
+			estimatedTime := u.graph.After * app.Config.OperationCalculationTime
+			output.EstimatedTime = &estimatedTime
+			op, _ := app.Database.Get(output.Id)
+			op.Expression = output.Derivative
+			op.Variables = u.usedVariables
+			app.Database.Update(op)
+		}
+
+		app.Database.UpdatingMutex.Unlock()
+
+		var limitErr *limitError
+		if errors.As(err, &limitErr) {
+			writeLimitError(w, limitErr)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "failed to calculate derivative %s: %s", output.Derivative, err)
+			return
+		}
+		u.submit(r)
+	}
+
+	if output.Id != 0 {
+		w.WriteHeader(http.StatusCreated)
+	}
+	data, err := json.MarshalIndent(output, "", "    ")
+	if err != nil {
+		panic(err)
+	}
+	w.Write(data)
+}
+
+// validateVariable checks that the name can be used as a variable of differentiation.
+func validateVariable(name string) error {
+	tokens, err := expr.Tokenize(name)
+	if err != nil || len(tokens) != 2 || tokens[0].Kind != expr.Name {
+		return fmt.Errorf("variable must be a name, got %q", name)
+	}
+	if _, ok := expr.Constants[name]; ok || name == imaginaryUnit {
+		return fmt.Errorf("%s is a constant, it can't be a variable", name)
+	}
+	return nil
+}
+
+// expandFunctions replaces calls of user-defined functions with their bodies, so that they can be differentiated.
+// Calls are checked the same way as in function definitions.
+// expanded counts the nodes of expanded bodies, it is limited by maxExpandedNodes.
+func expandFunctions(tree expr.Node, funcs map[string]db.Function, depth int, expanded *int) (expr.Node, error) {
+	return expr.Rewrite(tree, func(node expr.Node) (expr.Node, error) {
+		if depth > 0 {
+			*expanded++
+			if *expanded > maxExpandedNodes {
+				return nil, errTooLargeExpansion
+			}
+		}
+
+		call, ok := node.(*expr.CallExpr)
+		if !ok {
+			return node, nil
+		}
+		err := validateCall(call, "", funcs)
+		if err != nil {
+			return nil, err
+		}
+		f, ok := funcs[call.Fun.Name]
+		if !ok {
+			return node, nil
+		}
+		if depth >= maxFunctionDepth {
+			return nil, expr.Errorf(call.Fun, "calls of function %s are nested too deeply, the limit is %d", f.Name, maxFunctionDepth)
+		}
+
+		// The definition is checked by validateCall
+		def, _ := expr.ParseDefinition(f.Definition)
+		args := make(map[string]expr.Node, len(def.Params))
+		for i, param := range def.Params {
+			args[param.Name] = call.Args[i]
+		}
+		body, err := expr.Rewrite(def.Body, func(node expr.Node) (expr.Node, error) {
+			if ident, ok := node.(*expr.Ident); ok && args[ident.Name] != nil {
+				return args[ident.Name], nil
+			}
+			return node, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		body, err = expandFunctions(body, funcs, depth+1, expanded)
+		if err != nil {
+			err = inFunction(f.Name, err)
+			// Only the outermost call is a part of the expression
+			if depth == 0 {
+				err = atCall(call, err)
+			}
+			return nil, err
+		}
+		return body, nil
+	})
+}
@@ -0,0 +1,284 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math-calc/internal/application"
+	"math-calc/internal/db"
+	"math-calc/internal/expr"
+	"math-calc/internal/operation"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+type functionInput struct {
+	// Definition is the source of the function, e.g. `f(x, y) = x^2 + y`.
+	Definition string `json:"definition"`
+}
+
+type functionOutput struct {
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+// functions handles /api/v1/functions/ and /api/v1/functions/{name}.
+func functions(w http.ResponseWriter, r *http.Request) {
+	userId, ok := authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	app := r.Context().Value("app").(*application.Application)
+	name := r.URL.Path[len("/api/v1/functions/"):]
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		listFunctions(w, app, userId)
+	case r.Method == http.MethodGet:
+		getFunction(w, app, userId, name)
+	case r.Method == http.MethodPost && name == "":
+		postFunction(w, r, app, userId)
+	case r.Method == http.MethodDelete && name != "":
+		deleteFunction(w, app, userId, name)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func listFunctions(w http.ResponseWriter, app *application.Application, userId int) {
+	funcs, err := app.Database.GetFunctions(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to get functions: %s", err)
+		return
+	}
+
+	result := make([]functionOutput, 0, len(funcs))
+	for _, f := range funcs {
+		result = append(result, functionOutput{Name: f.Name, Definition: f.Definition})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	data, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		panic(err)
+	}
+	w.Write(data)
+}
+
+func getFunction(w http.ResponseWriter, app *application.Application, userId int, name string) {
+	funcs, err := app.Database.GetFunctions(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to get functions: %s", err)
+		return
+	}
+
+	f, ok := funcs[name]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "function not found")
+		return
+	}
+
+	data, err := json.MarshalIndent(functionOutput{Name: f.Name, Definition: f.Definition}, "", "    ")
+	if err != nil {
+		panic(err)
+	}
+	w.Write(data)
+}
+
+func postFunction(w http.ResponseWriter, r *http.Request, app *application.Application, userId int) {
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to read request body: %s", err)
+		return
+	}
+
+	input := functionInput{}
+	err = json.Unmarshal(body, &input)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "failed to unparse json: %s", err)
+		return
+	}
+
+	def, err := expr.ParseDefinition(input.Definition)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "failed to parse definition: %s", err)
+		return
+	}
+
+	funcs, err := app.Database.GetFunctions(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to get functions: %s", err)
+		return
+	}
+
+	err = validateDefinition(def, funcs)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "invalid definition: %s", err)
+		return
+	}
+
+	f := db.Function{OwnerID: userId, Name: def.Name.Name, Definition: input.Definition}
+	err = app.Database.SetFunction(f)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to save function: %s", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	data, err := json.MarshalIndent(functionOutput{Name: f.Name, Definition: f.Definition}, "", "    ")
+	if err != nil {
+		panic(err)
+	}
+	w.Write(data)
+}
+
+func deleteFunction(w http.ResponseWriter, app *application.Application, userId int, name string) {
+	err := app.Database.DeleteFunction(userId, name)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "function not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// validateDefinition checks that the body of a function uses only its parameters and constants,
+// and calls only functions that exist, with the right number of arguments. Direct recursion is not allowed.
+func validateDefinition(def *expr.Definition, funcs map[string]db.Function) error {
+	name := def.Name.Name
+	if _, ok := operation.LookupFunction(name); ok || name == string(operation.Conditional) {
+		return expr.Errorf(def.Name, "%s is a built-in function", name)
+	}
+
+	params := make(map[string]bool, len(def.Params))
+	for _, param := range def.Params {
+		if params[param.Name] {
+			return expr.Errorf(param, "duplicate parameter %s", param.Name)
+		}
+		params[param.Name] = true
+	}
+
+	var err error
+	var first *expr.Ident
+	var unbound []string
+	seen := make(map[string]bool)
+	expr.Inspect(def.Body, func(node expr.Node) bool {
+		if err != nil {
+			return false
+		}
+
+		switch n := node.(type) {
+		case *expr.Ident:
+			_, isConstant := expr.Constants[n.Name]
+			if params[n.Name] || isConstant || n.Name == imaginaryUnit || seen[n.Name] {
+				return true
+			}
+			seen[n.Name] = true
+			if first == nil {
+				first = n
+			}
+			unbound = append(unbound, n.Name)
+		case *expr.CallExpr:
+			err = validateCall(n, name, funcs)
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(unbound) == 0 {
+		return nil
+	}
+	sort.Strings(unbound)
+	return expr.Errorf(first, "unbound identifiers: %s", strings.Join(unbound, ", "))
+}
+
+// validateCall checks a call inside the body of the function with the given name.
+func validateCall(call *expr.CallExpr, name string, funcs map[string]db.Function) error {
+	callee := call.Fun.Name
+	switch {
+	case callee == name:
+		return expr.Errorf(call.Fun, "function %s can't call itself", name)
+	case callee == string(operation.Conditional):
+		if len(call.Args) != 3 {
+			return expr.Errorf(call, "function if expects 3 argument(s), got %d", len(call.Args))
+		}
+		return nil
+	}
+
+	if fn, ok := operation.LookupFunction(callee); ok {
+		if !fn.AcceptsArgs(len(call.Args)) {
+			return expr.Errorf(call, "function %s expects %s, got %d", callee, describeArity(fn), len(call.Args))
+		}
+		return nil
+	}
+
+	f, ok := funcs[callee]
+	if !ok {
+		return expr.Errorf(call.Fun, "unknown function %s", callee)
+	}
+	def, err := expr.ParseDefinition(f.Definition)
+	if err != nil {
+		return expr.Errorf(call.Fun, "function %s is malformed: %s", callee, err)
+	}
+	if len(call.Args) != len(def.Params) {
+		return expr.Errorf(call, "function %s expects %d argument(s), got %d", callee, len(def.Params), len(call.Args))
+	}
+	return nil
+}
+
+// errTooLargeExpansion is returned once calls of user-defined functions expand into more than maxExpandedNodes nodes.
+var errTooLargeExpansion = fmt.Errorf("calls of functions are too large when expanded, the limit is %d nodes", maxExpandedNodes)
+
+// functionError is an error in the body of a user-defined function. Positions in the body refer to
+// the definition rather than to the expression, so the error is reported at the call instead, see atCall.
+type functionError struct {
+	// name is the innermost function which body contains the error.
+	name string
+	msg  string
+}
+
+func (e *functionError) Error() string {
+	return fmt.Sprintf("function %s: %s", e.name, e.msg)
+}
+
+// inFunction wraps an error in the body of the function with the given name.
+// Errors of nested calls are wrapped once, by the innermost function. Exceeded quotas are not wrapped.
+func inFunction(name string, err error) error {
+	var fnErr *functionError
+	var limitErr *limitError
+	if errors.As(err, &fnErr) || errors.As(err, &limitErr) {
+		return err
+	}
+	msg := err.Error()
+	var exprErr *expr.Error
+	if errors.As(err, &exprErr) {
+		msg = exprErr.Msg
+	}
+	return &functionError{name: name, msg: msg}
+}
+
+// atCall returns an error of a function body pointing at the call of the function in the expression.
+func atCall(call *expr.CallExpr, err error) error {
+	var fnErr *functionError
+	if !errors.As(err, &fnErr) {
+		return err
+	}
+	return expr.Errorf(call, "%s", fnErr)
+}
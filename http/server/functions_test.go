@@ -0,0 +1,68 @@
+package server
+
+import (
+	"fmt"
+	"math-calc/internal/db"
+	"math-calc/internal/expr"
+	"math-calc/internal/operation"
+	"strings"
+	"testing"
+)
+
+// doublingFunctions returns functions f0..fn where every function calls the previous one twice.
+func doublingFunctions(n int) map[string]db.Function {
+	funcs := map[string]db.Function{"f0": {Name: "f0", Definition: "f0(x) = x + 1"}}
+	for i := 1; i <= n; i++ {
+		name := fmt.Sprintf("f%d", i)
+		funcs[name] = db.Function{Name: name, Definition: fmt.Sprintf("%s(x) = f%d(x * 2) + f%d(x * 3)", name, i-1, i-1)}
+	}
+	return funcs
+}
+
+func TestFunctionExpansionLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		functions  int
+		err        bool
+	}{
+		{"few calls", "f5(y)", 5, false},
+		{"nested calls", "f15(y)", 15, true},
+		{"nested calls in arguments", "f0(f0(f14(y)))", 14, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			funcs := doublingFunctions(tt.functions)
+			tree, err := expr.Parse(tt.expression)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %s", tt.expression, err)
+			}
+
+			u := newUnparser(nil, 1, operation.Operation{Mode: operation.ModeFloat}, map[string]float64{"y": 1})
+			u.functions = funcs
+			_, err = u.unparseTree(tree)
+			checkExpansionError(t, "unparseTree", err, tt.err)
+			if len(u.plan) > maxExpandedNodes {
+				t.Errorf("unparseTree planned %d operations, the limit is %d", len(u.plan), maxExpandedNodes)
+			}
+
+			var expanded int
+			_, err = expandFunctions(tree, funcs, 0, &expanded)
+			checkExpansionError(t, "expandFunctions", err, tt.err)
+		})
+	}
+}
+
+func checkExpansionError(t *testing.T, name string, err error, want bool) {
+	t.Helper()
+	if !want {
+		if err != nil {
+			t.Errorf("%s returned error: %s", name, err)
+		}
+		return
+	}
+	if err == nil || !strings.Contains(err.Error(), errTooLargeExpansion.Error()) {
+		t.Errorf("%s returned error %v, want %s", name, err, errTooLargeExpansion)
+	}
+}
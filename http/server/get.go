@@ -3,22 +3,43 @@ package server
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"math-calc/internal/application"
+	"math-calc/internal/expr"
 	"math-calc/internal/operation"
+	"math/cmplx"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 )
 
 type getResult struct {
-	Id           operation.ID `json:"id"`
-	Type         string       `json:"type"`
-	Expression   string       `json:"expression"`
-	Status       string       `json:"status"`
-	Result       float64      `json:"result"`
-	CreatedTime  time.Time    `json:"created_time"`
-	FinishedTime time.Time    `json:"finished_time"`
+	Id         operation.ID `json:"id"`
+	Type       string       `json:"type"`
+	Expression string       `json:"expression"`
+	// Canonical, LaTeX and MathML are renderings of the operation graph, so they are set for sub-operations too.
+	// Results of finished sub-operations are rendered as the sub-operations themselves.
+	Canonical string             `json:"canonical,omitempty"`
+	LaTeX     string             `json:"latex,omitempty"`
+	MathML    string             `json:"mathml,omitempty"`
+	Variables map[string]float64 `json:"variables,omitempty"`
+	Mode      operation.Mode     `json:"mode"`
+	Precision int                `json:"precision,omitempty"`
+	Rounding  string             `json:"rounding,omitempty"`
+	Priority  int                `json:"priority,omitempty"`
+	Status    string             `json:"status"`
+	// Result is a float approximation of the result. It is null if the result doesn't fit into float64.
+	Result *float64 `json:"result"`
+	// Exact is the lossless result in modes other than float, e.g. "1/3" in rational mode.
+	Exact string `json:"exact,omitempty"`
+	// Array is the result if it is a vector or a matrix: nested JSON arrays of elements in the form of Exact,
+	// see operation.Array. Result and Exact are empty then.
+	Array json.RawMessage `json:"array,omitempty"`
+	// Real and Imag are parts of the result in complex mode. Result holds the real part then.
+	Real         *float64  `json:"real,omitempty"`
+	Imag         *float64  `json:"imag,omitempty"`
+	CreatedTime  time.Time `json:"created_time"`
+	FinishedTime time.Time `json:"finished_time"`
 }
 
 func getExpression(w http.ResponseWriter, r *http.Request) {
@@ -27,17 +48,8 @@ func getExpression(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	bearerToken := r.Header.Get("Authorization")
-	if bearerToken == "" {
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprintln(w, "missing Authorization header")
-		return
-	}
-	bearerToken, _ = strings.CutPrefix(bearerToken, "Bearer ")
-	userId, err := checkJWT(bearerToken)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		fmt.Fprintln(w, "invalid token")
+	userId, ok := authenticate(w, r)
+	if !ok {
 		return
 	}
 
@@ -83,6 +95,10 @@ func getExpression(w http.ResponseWriter, r *http.Request) {
 		status = "done"
 	case operation.StateError:
 		status = fmt.Sprintf("error: %s", op.Error)
+	case operation.StateDeferred:
+		status = "waiting for condition"
+	case operation.StateSkipped:
+		status = "skipped, the branch was not chosen"
 	}
 
 	opType := "operation"
@@ -94,11 +110,37 @@ func getExpression(w http.ResponseWriter, r *http.Request) {
 		Id:           op.Id,
 		Type:         opType,
 		Expression:   op.Expression,
+		Variables:    op.Variables,
+		Mode:         op.Mode,
+		Precision:    op.Precision,
+		Rounding:     string(op.Rounding),
+		Priority:     op.Priority,
 		Status:       status,
-		Result:       op.Result,
+		Exact:        op.ResultExact,
 		CreatedTime:  op.CreatedTime,
 		FinishedTime: op.FinishedTime,
 	}
+	tree, err := newRenderer(app).render(op.Id)
+	if err != nil {
+		app.Logger.Printf("failed to render operation %d: %s\n", op.Id, err)
+	} else {
+		result.Canonical = expr.Format(tree)
+		result.LaTeX = expr.LaTeX(tree)
+		result.MathML = expr.MathML(tree)
+	}
+	if op.Mode == operation.ModeComplex && op.State == operation.StateDone {
+		c, err := op.ResultOperand().Complex()
+		if err == nil && !cmplx.IsInf(c) && !cmplx.IsNaN(c) {
+			re, im := real(c), imag(c)
+			result.Real, result.Imag = &re, &im
+		}
+	}
+	if op.ResultOperand().IsArray() {
+		result.Array = json.RawMessage(op.ResultExact)
+		result.Exact = ""
+	} else if !math.IsInf(op.Result, 0) && !math.IsNaN(op.Result) {
+		result.Result = &op.Result
+	}
 	data, err := json.MarshalIndent(result, "", "    ")
 	if err != nil {
 		app.Logger.Printf("failed to marshal result: %s\n", err)
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math-calc/internal/operation"
+	"net/http"
+	"time"
+)
+
+// limitError means that a request exceeds one of the quotas of the user, see config.Limits.
+// It is written as a JSON body, see writeLimitError.
+type limitError struct {
+	status  int
+	Message string `json:"error"`
+	// Limit is the name of the exceeded quota as in config.json.
+	Limit string `json:"limit"`
+	Max   int    `json:"max"`
+	// Value is what the quota would be with the request accepted.
+	Value int `json:"value"`
+}
+
+func (e *limitError) Error() string {
+	return fmt.Sprintf("%s: %s is %d, but at most %d is allowed", e.Message, e.Limit, e.Value, e.Max)
+}
+
+// writeLimitError responds with 429 if the user has to wait, or with 413 if the expression is too large anyway.
+func writeLimitError(w http.ResponseWriter, e *limitError) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		panic(err)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(e.status)
+	w.Write(data)
+}
+
+// checkSize returns a limitError if an expression of count operations with the longest chain of depth operations
+// exceeds quotas of the user. It is called for every planned operation, so that planning stops at the first one
+// exceeding a quota.
+func (u *unparser) checkSize(count, depth int) error {
+	limits := u.limits
+	if limits.ExpressionOperations > 0 && count > limits.ExpressionOperations {
+		return &limitError{http.StatusRequestEntityTooLarge, "expression has too many operations", "expression_operations", limits.ExpressionOperations, count}
+	}
+	if limits.ExpressionDepth > 0 && depth > limits.ExpressionDepth {
+		return &limitError{http.StatusRequestEntityTooLarge, "expression is nested too deeply", "expression_depth", limits.ExpressionDepth, depth}
+	}
+	return nil
+}
+
+// checkLimits returns a limitError if storing the planned operations root depends on exceeds quotas of the user
+// which depend on other expressions. The size of the expression is checked while it is planned, see checkSize.
+// It has to be called while the database is locked for updates, so that concurrent requests are counted.
+func (u *unparser) checkLimits(root operation.ID) error {
+	limits := u.limits
+
+	if limits.ExpressionsPerHour > 0 {
+		created, err := u.app.Database.CountExpressions(u.ownerId, time.Now().Add(-time.Hour))
+		if err != nil {
+			return fmt.Errorf("failed to count expressions: %w", err)
+		}
+		if created+1 > limits.ExpressionsPerHour {
+			return &limitError{http.StatusTooManyRequests, "too many expressions created in the last hour", "expressions_per_hour", limits.ExpressionsPerHour, created + 1}
+		}
+	}
+
+	if limits.ActiveOperations > 0 {
+		count := len(u.reachable(root))
+		active, err := u.app.Database.CountActive(u.ownerId)
+		if err != nil {
+			return fmt.Errorf("failed to count operations: %w", err)
+		}
+		if active+count > limits.ActiveOperations {
+			return &limitError{http.StatusTooManyRequests, "too many operations are being calculated", "active_operations", limits.ActiveOperations, active + count}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"errors"
+	"math-calc/internal/config"
+	"math-calc/internal/db"
+	"math-calc/internal/expr"
+	"math-calc/internal/operation"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestSizeLimits(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		limits     config.Limits
+		// limit is the name of the exceeded quota, empty if the expression fits
+		limit string
+		value int
+	}{
+		{"fits", "1 + 2 * 3 - 4", config.Limits{ExpressionOperations: 3, ExpressionDepth: 3}, "", 0},
+		{"too many operations", "1 + 2 + 3 + 4 + 5", config.Limits{ExpressionOperations: 3}, "expression_operations", 4},
+		{"too deep", "1 + 2 + 3 + 4 + 5", config.Limits{ExpressionDepth: 2}, "expression_depth", 3},
+		{"shared operations are counted once", "(1 + 2) * (1 + 2) + (1 + 2)", config.Limits{ExpressionOperations: 3}, "", 0},
+		{"conditional takes no time", "if(1 < 2, 3 + 4, 5)", config.Limits{ExpressionDepth: 2}, "", 0},
+		{"branch after condition", "if(1 < 2, 3 + 4 + 5, 6)", config.Limits{ExpressionDepth: 2}, "expression_depth", 3},
+		{"in function body", "g(1)", config.Limits{ExpressionOperations: 3}, "expression_operations", 4},
+		{"many operations", strings.Repeat("1 + ", 100000) + "1", config.Limits{ExpressionOperations: 10}, "expression_operations", 11},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := expr.Parse(tt.expression)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %s", tt.expression, err)
+			}
+			u := newUnparser(nil, 1, operation.Operation{Mode: operation.ModeFloat}, nil)
+			u.functions = map[string]db.Function{"g": {Name: "g", Definition: "g(x) = x + 1 + 2 + 3 + 4"}}
+			u.limits = tt.limits
+			_, err = u.unparseTree(tree)
+
+			if tt.limit == "" {
+				if err != nil {
+					t.Errorf("unparseTree returned error: %s", err)
+				}
+				return
+			}
+			var limitErr *limitError
+			if !errors.As(err, &limitErr) {
+				t.Fatalf("unparseTree returned %v, want *limitError", err)
+			}
+			if limitErr.status != http.StatusRequestEntityTooLarge || limitErr.Limit != tt.limit || limitErr.Value != tt.value {
+				t.Errorf("unparseTree exceeded %s with value %d and status %d, want %s with value %d and status 413",
+					limitErr.Limit, limitErr.Value, limitErr.status, tt.limit, tt.value)
+			}
+			if max := tt.limits.ExpressionOperations; max > 0 && len(u.plan) > max {
+				t.Errorf("unparseTree planned %d operations, the limit is %d", len(u.plan), max)
+			}
+		})
+	}
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"math"
+	"math-calc/internal/operation"
+	"math-calc/internal/orchestrator"
+)
+
+// fold replaces planned operations which results are known in advance and returns the new root.
+// Cheap operations with literal operands are calculated right away, see cheap, and identities like x*1 are removed.
+// In float mode, only identities which keep results bit-for-bit equal are applied.
+// The root itself is never replaced with a literal, so the expression still has an operation.
+func (u *unparser) fold(root operation.ID) operation.ID {
+	replaced := make(map[operation.ID]operation.Operand)
+
+	// Dependencies are always planned before the operations using them
+	for i := range u.plan {
+		p := &u.plan[i]
+		for j, operand := range p.Operands {
+			if r, ok := replaced[operand.OperationID]; ok {
+				p.Operands[j] = r
+			}
+		}
+
+		id := placeholderID(i)
+		result, ok := u.foldOperation(p.Operation)
+		if !ok || id == root && result.OperationID == 0 {
+			continue
+		}
+		replaced[id] = result
+	}
+
+	// The root has to remain an operation of this expression
+	if r, ok := replaced[root]; ok && u.planned(r.OperationID) != nil {
+		return r.OperationID
+	}
+	return root
+}
+
+// foldOperation returns the result of op if it can be found without calculating op.
+func (u *unparser) foldOperation(op operation.Operation) (operation.Operand, bool) {
+	literals := true
+	for _, operand := range op.Operands {
+		literals = literals && operand.OperationID == 0
+	}
+	if literals {
+		if !cheap(op) {
+			return operation.Operand{}, false
+		}
+		result, err := orchestrator.Calculate(op, 0)
+		// Failing operations are left for workers, so the error is reported as usual
+		return result, err == nil
+	}
+
+	// Complex arithmetic isn't exact even for identities, e.g. (inf+1i)*1 is not inf+1i
+	if op.Mode == operation.ModeComplex || len(op.Operands) != 2 {
+		return operation.Operand{}, false
+	}
+	x, y := op.Operands[0], op.Operands[1]
+	exact := op.Mode != operation.ModeFloat
+
+	switch op.Op {
+	case operation.Multiply:
+		switch {
+		case u.isLiteral(op.Mode, y, true):
+			return x, true
+		case u.isLiteral(op.Mode, x, true):
+			return y, true
+		// In float mode, x*0 is -0 for negative x and NaN for infinite x
+		case exact && u.isLiteral(op.Mode, y, false) && u.cannotFail(op.Mode, x):
+			return y, true
+		case exact && u.isLiteral(op.Mode, x, false) && u.cannotFail(op.Mode, y):
+			return x, true
+		}
+	case operation.Division:
+		if u.isLiteral(op.Mode, y, true) {
+			return x, true
+		}
+	case operation.Addition:
+		// In float mode, -0 + 0 is 0
+		switch {
+		case exact && u.isLiteral(op.Mode, y, false):
+			return x, true
+		case exact && u.isLiteral(op.Mode, x, false):
+			return y, true
+		}
+	case operation.Subtraction:
+		// x - 0 is x even for x = -0, but x - (-0) is not
+		if u.isLiteral(op.Mode, y, false) && !math.Signbit(y.Value) {
+			return x, true
+		}
+	}
+	return operation.Operand{}, false
+}
+
+// maxFoldedLength limits the length of operands of operations folded in exact modes, see cheap.
+const maxFoldedLength = 100
+
+// cheapExact are the operators which are calculated fast in exact modes if their operands are short.
+var cheapExact = map[operation.Operator]bool{
+	operation.Addition:     true,
+	operation.Subtraction:  true,
+	operation.Multiply:     true,
+	operation.Negation:     true,
+	operation.Equal:        true,
+	operation.NotEqual:     true,
+	operation.Less:         true,
+	operation.LessEqual:    true,
+	operation.Greater:      true,
+	operation.GreaterEqual: true,
+	operation.And:          true,
+	operation.Or:           true,
+	operation.Not:          true,
+}
+
+// cheap reports whether op with literal operands may be calculated by fold. It runs while the database is locked,
+// so arrays, powers, factorials and other operations which may take long in exact modes are left for workers.
+func cheap(op operation.Operation) bool {
+	for _, operand := range op.Operands {
+		if operand.IsArray() {
+			return false
+		}
+	}
+	if op.Mode == operation.ModeFloat || op.Mode == operation.ModeComplex {
+		return true
+	}
+
+	if !cheapExact[op.Op] {
+		return false
+	}
+	for _, operand := range op.Operands {
+		if len(operand.Exact) > maxFoldedLength {
+			return false
+		}
+	}
+	return true
+}
+
+// isLiteral reports whether x is a literal equal to 1 if one is set, or to 0 otherwise.
+func (u *unparser) isLiteral(mode operation.Mode, x operation.Operand, one bool) bool {
+	if x.OperationID != 0 || x.IsArray() {
+		return false
+	}
+	equal, err := operation.Equals(mode, x, operation.Bool(mode, one))
+	return err == nil && equal
+}
+
+// neverFailing are the operators which can't fail in exact modes if their operands are known.
+var neverFailing = map[operation.Operator]bool{
+	operation.Addition:     true,
+	operation.Subtraction:  true,
+	operation.Negation:     true,
+	operation.Equal:        true,
+	operation.NotEqual:     true,
+	operation.Less:         true,
+	operation.LessEqual:    true,
+	operation.Greater:      true,
+	operation.GreaterEqual: true,
+	operation.And:          true,
+	operation.Or:           true,
+	operation.Not:          true,
+	"abs":                  true,
+	"min":                  true,
+	"max":                  true,
+	"sum":                  true,
+	"floor":                true,
+	"ceil":                 true,
+	"round":                true,
+}
+
+// cannotFail reports whether calculating x can't fail and results in a number, so that it may be replaced with 0.
+// Results of other expressions are not known in advance, so they may always fail.
+func (u *unparser) cannotFail(mode operation.Mode, x operation.Operand) bool {
+	if x.OperationID == 0 {
+		return !x.IsArray()
+	}
+	p := u.planned(x.OperationID)
+	if p == nil {
+		return false
+	}
+
+	// Integer products are limited in size
+	if !neverFailing[p.Op] && !(p.Op == operation.Multiply && mode != operation.ModeInteger) {
+		return false
+	}
+	for _, operand := range p.Operands {
+		if !u.cannotFail(mode, operand) {
+			return false
+		}
+	}
+	return true
+}
+
+// associative are the operators which chains can be balanced.
+var associative = map[operation.Operator]bool{
+	operation.Addition: true,
+	operation.Multiply: true,
+	operation.And:      true,
+	operation.Or:       true,
+}
+
+// balanceChains rewrites chains of associative operations, e.g. 1+2+3+4 = ((1+2)+3)+4,
+// into balanced trees like (1+2)+(3+4), so that more operations can be calculated in parallel.
+// A chain of n operands then takes log2(n) steps instead of n-1.
+// The order of operands is kept. In float, decimal and complex modes this may change results due to rounding.
+func (u *unparser) balanceChains(root operation.ID) {
+	uses := make(map[operation.ID]int)
+	var count func(id operation.ID)
+	count = func(id operation.ID) {
+		p := u.planned(id)
+		if p == nil {
+			return
+		}
+		uses[id]++
+		if uses[id] > 1 {
+			return
+		}
+		for _, operand := range p.Operands {
+			count(operand.OperationID)
+		}
+	}
+	count(root)
+
+	visited := make(map[operation.ID]bool)
+	var visit func(id operation.ID)
+	visit = func(id operation.ID) {
+		if u.planned(id) == nil || visited[id] {
+			return
+		}
+		visited[id] = true
+
+		p := *u.planned(id)
+		if !associative[p.Op] {
+			for _, operand := range p.Operands {
+				visit(operand.OperationID)
+			}
+			return
+		}
+
+		leaves := u.chainLeaves(p, uses)
+		if len(leaves) > 2 {
+			half := len(leaves) / 2
+			operands := []operation.Operand{u.balance(p, leaves[:half]), u.balance(p, leaves[half:])}
+			// The root of the chain is kept, as other operations refer to it.
+			// It is looked up after balance, which may have moved the plan.
+			u.planned(id).Operands = operands
+		}
+		for _, leaf := range leaves {
+			visit(leaf.OperationID)
+		}
+	}
+	visit(root)
+}
+
+// chainLeaves returns operands of a chain of operations like p, in order.
+// Operations used elsewhere or belonging to other branches end the chain, as they can't be rewritten.
+func (u *unparser) chainLeaves(p plannedOperation, uses map[operation.ID]int) []operation.Operand {
+	var leaves []operation.Operand
+	for _, operand := range p.Operands {
+		q := u.planned(operand.OperationID)
+		if q == nil || q.Op != p.Op || uses[operand.OperationID] != 1 || len(q.scopes) != len(p.scopes) {
+			leaves = append(leaves, operand)
+			continue
+		}
+		leaves = append(leaves, u.chainLeaves(*q, uses)...)
+	}
+	return leaves
+}
+
+// balance plans a balanced tree of operations like p applied to the leaves.
+func (u *unparser) balance(p plannedOperation, leaves []operation.Operand) operation.Operand {
+	if len(leaves) == 1 {
+		return leaves[0]
+	}
+
+	half := len(leaves) / 2
+	op := p.Operation
+	op.Operands = []operation.Operand{u.balance(p, leaves[:half]), u.balance(p, leaves[half:])}
+	id := placeholderID(len(u.plan))
+	u.plan = append(u.plan, plannedOperation{Operation: op, scopes: p.scopes})
+	return operation.Operand{OperationID: id}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"math"
+	"math-calc/internal/expr"
+	"math-calc/internal/operation"
+	"math-calc/internal/orchestrator"
+	"testing"
+)
+
+// storedX is the id of the stored operation x refers to in tests, so that x isn't known in advance.
+const storedX operation.ID = 1000
+
+// planFloat plans the expression in float mode with x bound to the result of storedX and returns its root.
+func planFloat(t *testing.T, expression string) (*unparser, operation.ID) {
+	t.Helper()
+	tree, err := expr.Parse(expression)
+	if err != nil {
+		t.Fatalf("Parse(%q) returned error: %s", expression, err)
+	}
+	u := newUnparser(nil, 1, operation.Operation{Mode: operation.ModeFloat}, nil)
+	u.params = map[string]unparseResult{"x": {OperationID: storedX}}
+	result, err := u.unparseTree(tree)
+	if err != nil {
+		t.Fatalf("unparseTree(%q) returned error: %s", expression, err)
+	}
+	if result.OperationID == 0 {
+		t.Fatalf("expression %q has no operations", expression)
+	}
+	return u, result.OperationID
+}
+
+// evaluate calculates the planned operation like workers do, with x equal to the given value.
+func evaluate(t *testing.T, u *unparser, x operation.Operand, value float64) float64 {
+	t.Helper()
+	if x.OperationID == 0 {
+		return x.Value
+	}
+	p := u.planned(x.OperationID)
+	if p == nil {
+		return value
+	}
+
+	op := p.Operation
+	op.Operands = make([]operation.Operand, len(p.Operands))
+	for i, operand := range p.Operands {
+		op.Operands[i] = operation.Operand{Value: evaluate(t, u, operand, value)}
+	}
+	result, err := orchestrator.Calculate(op, 0)
+	if err != nil {
+		t.Fatalf("operation %s returned error: %s", op.Op, err)
+	}
+	return result.Value
+}
+
+func TestFoldKeepsFloatResults(t *testing.T) {
+	expressions := []string{
+		"x + 0",
+		"0 + x",
+		"x + -0",
+		"x - 0",
+		"x - -0",
+		"x * 0",
+		"0 * x",
+		"x * 1",
+		"1 * x",
+		"x / 1",
+		"x * (2 - 1)",
+		"x + (1 - 1)",
+		"(x * 1 + 0) * 0",
+		"-x * 0",
+	}
+	values := []float64{0, math.Copysign(0, -1), -5, 2.5, math.Inf(1), math.Inf(-1), math.NaN()}
+
+	for _, expression := range expressions {
+		t.Run(expression, func(t *testing.T) {
+			// The root is never replaced by fold, so the expression is used as an operand
+			plain, plainRoot := planFloat(t, "("+expression+") * 2")
+			optimized, root := planFloat(t, "("+expression+") * 2")
+			root = optimized.fold(root)
+
+			for _, value := range values {
+				want := evaluate(t, plain, operation.Operand{OperationID: plainRoot}, value)
+				got := evaluate(t, optimized, operation.Operand{OperationID: root}, value)
+				if math.Float64bits(got) != math.Float64bits(want) && !(math.IsNaN(got) && math.IsNaN(want)) {
+					t.Errorf("with x = %g the optimized expression gives %g, want %g", value, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestFoldRemovesIdentities(t *testing.T) {
+	tests := []struct {
+		expression string
+		// operations is the number of operations left after folding
+		operations int
+	}{
+		{"x * 1", 1},
+		{"x / 1 - 0 + 1", 1},
+		{"x * (3 - 2) + 2 * 3", 1},
+		{"(x + 1) * 1 * 1", 1},
+		// Not identities in float mode
+		{"(x + 0) * 2", 2},
+		{"x * 0 + 1", 2},
+		{"(x - -0) * 2", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			u, root := planFloat(t, tt.expression)
+			root = u.fold(root)
+			if got := len(u.reachable(root)); got != tt.operations {
+				t.Errorf("%d operations are left after folding, want %d", got, tt.operations)
+			}
+		})
+	}
+}
+
+func TestBalanceChainsDepth(t *testing.T) {
+	tests := []struct {
+		expression string
+		before     int
+		after      int
+	}{
+		{"1+2+3+4+5+6+7+8", 7, 3},
+		{"1*2*3*4*5", 4, 3},
+		{"x+1+2+3", 3, 2},
+		{"1+2-3+4", 3, 3},
+		{"(1+2)*(3+4)", 2, 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			u, root := planFloat(t, tt.expression)
+			want := evaluate(t, u, operation.Operand{OperationID: root}, 0)
+
+			before := u.graphDepth(root)
+			u.balanceChains(root)
+			after := u.graphDepth(root)
+			if before != tt.before || after != tt.after {
+				t.Errorf("depth before and after balancing is %d and %d, want %d and %d", before, after, tt.before, tt.after)
+			}
+			if got := evaluate(t, u, operation.Operand{OperationID: root}, 0); got != want {
+				t.Errorf("balanced expression gives %g, want %g", got, want)
+			}
+		})
+	}
+}
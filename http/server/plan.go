@@ -0,0 +1,197 @@
+package server
+
+import (
+	"fmt"
+	"math-calc/internal/operation"
+)
+
+// plannedOperation is an operation of the expression which is not stored yet.
+// Operands refer to other planned operations by placeholder ids, see placeholderID.
+type plannedOperation struct {
+	operation.Operation
+	// scopes are the conditional branches the operation belongs to, outermost first.
+	// The first one is always 0, the expression itself.
+	scopes []int
+	// depth is the length of the longest chain of planned operations ending with this one, as in graphDepth.
+	// It is not updated by the optimizer.
+	depth int
+}
+
+// placeholderID returns the id referring to the i-th planned operation until it is stored.
+// Placeholders are negative, so they never clash with ids of stored operations.
+func placeholderID(i int) operation.ID {
+	return operation.ID(-1 - i)
+}
+
+// planIndex returns the index of the planned operation the id refers to.
+// It returns false for ids of stored operations.
+func planIndex(id operation.ID) (int, bool) {
+	if id >= 0 {
+		return 0, false
+	}
+	return int(-1 - id), true
+}
+
+// sharedKey returns the key of an operation with the given key in the given scope, see unparser.operations.
+func sharedKey(scope int, key string) string {
+	return fmt.Sprintf("%d:%s", scope, key)
+}
+
+// findShared looks up an operation with the given key in the scopes, innermost first.
+func findShared(shared map[string]operation.ID, scopes []int, key string) (operation.ID, bool) {
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if id, ok := shared[sharedKey(scopes[i], key)]; ok {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+// planned returns the planned operation the id refers to, or nil for stored operations and literals.
+func (u *unparser) planned(id operation.ID) *plannedOperation {
+	i, ok := planIndex(id)
+	if !ok {
+		return nil
+	}
+	return &u.plan[i]
+}
+
+// store creates the planned operations root depends on, dependencies first, and returns the id of root.
+// Operations which are not reachable from root, e.g. replaced by the optimizer, are not stored.
+// Operations that became identical after optimization are stored once.
+func (u *unparser) store(root operation.ID) (operation.ID, error) {
+	stored := make(map[operation.ID]operation.ID)
+	shared := make(map[string]operation.ID)
+	paths := u.criticalPaths(root)
+
+	var visit func(id operation.ID) (operation.ID, error)
+	visit = func(id operation.ID) (operation.ID, error) {
+		p := u.planned(id)
+		if p == nil {
+			return id, nil
+		}
+		if storedID, ok := stored[id]; ok {
+			return storedID, nil
+		}
+
+		op := p.Operation
+		op.CriticalPath = paths[id]
+		op.Operands = make([]operation.Operand, len(p.Operands))
+		for i, operand := range p.Operands {
+			var err error
+			operand.OperationID, err = visit(operand.OperationID)
+			if err != nil {
+				return 0, err
+			}
+			op.Operands[i] = operand
+		}
+
+		key := op.Key()
+		storedID, ok := findShared(shared, p.scopes, key)
+		if !ok {
+			var err error
+			storedID, err = u.app.Database.Create(op)
+			if err != nil {
+				return 0, err
+			}
+			shared[sharedKey(p.scopes[len(p.scopes)-1], key)] = storedID
+			if op.State != operation.StateDeferred {
+				u.created = append(u.created, storedID)
+			}
+		}
+		stored[id] = storedID
+		return storedID, nil
+	}
+	return visit(root)
+}
+
+// reachable returns the planned operations root depends on, including root itself, dependencies first.
+func (u *unparser) reachable(root operation.ID) []operation.ID {
+	var order []operation.ID
+	visited := make(map[operation.ID]bool)
+	var visit func(id operation.ID)
+	visit = func(id operation.ID) {
+		p := u.planned(id)
+		if p == nil || visited[id] {
+			return
+		}
+		visited[id] = true
+		for _, operand := range p.Operands {
+			visit(operand.OperationID)
+		}
+		order = append(order, id)
+	}
+	visit(root)
+	return order
+}
+
+// criticalPaths returns the number of planned operations which have to be calculated after each operation
+// on the longest chain to root, see operation.Operation.CriticalPath. Like in graphDepth, conditionals take no time.
+func (u *unparser) criticalPaths(root operation.ID) map[operation.ID]int {
+	// Every operation is visited before its dependencies
+	order := u.reachable(root)
+	paths := make(map[operation.ID]int, len(order))
+	for i := len(order) - 1; i >= 0; i-- {
+		p := u.planned(order[i])
+		path := paths[order[i]]
+		if p.Op != operation.Conditional {
+			path++
+		}
+		for _, operand := range p.Operands {
+			if u.planned(operand.OperationID) != nil {
+				paths[operand.OperationID] = max(paths[operand.OperationID], path)
+			}
+		}
+	}
+	return paths
+}
+
+// plannedDepth returns the depth of a planned operation applying op to the operands, see plannedOperation.depth.
+func (u *unparser) plannedDepth(op operation.Operator, operands []operation.Operand) int {
+	depth := func(x operation.Operand) int {
+		if p := u.planned(x.OperationID); p != nil {
+			return p.depth
+		}
+		return 0
+	}
+
+	if op == operation.Conditional {
+		return depth(operands[0]) + max(depth(operands[1]), depth(operands[2]))
+	}
+	d := 0
+	for _, operand := range operands {
+		d = max(d, depth(operand))
+	}
+	return d + 1
+}
+
+// graphDepth returns the length of the longest chain of planned operations root depends on.
+// The branch of a conditional starts once the condition is known, and the conditional itself takes no time.
+// Stored operations, e.g. results of other expressions, are not counted.
+func (u *unparser) graphDepth(root operation.ID) int {
+	depths := make(map[operation.ID]int)
+
+	var visit func(id operation.ID) int
+	visit = func(id operation.ID) int {
+		p := u.planned(id)
+		if p == nil {
+			return 0
+		}
+		if d, ok := depths[id]; ok {
+			return d
+		}
+
+		d := 0
+		if p.Op == operation.Conditional {
+			d = visit(p.Operands[0].OperationID) + max(visit(p.Operands[1].OperationID), visit(p.Operands[2].OperationID))
+		} else {
+			for _, operand := range p.Operands {
+				d = max(d, visit(operand.OperationID))
+			}
+			d++
+		}
+		depths[id] = d
+		return d
+	}
+	return visit(root)
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"math-calc/internal/application"
+	"math-calc/internal/decimal"
+	"math-calc/internal/expr"
+	"math-calc/internal/operation"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxRenderedNodes limits the size of rendered expressions.
+// Shared operations are rendered at every place they are used, so the tree may be much larger than the graph.
+const maxRenderedNodes = 10000
+
+// renderer converts stored operations back into expression trees,
+// so that any operation can be displayed, not only the ones created from an expression.
+type renderer struct {
+	app *application.Application
+	// sizes are the numbers of nodes of rendered operations.
+	sizes map[operation.ID]int
+	nodes map[operation.ID]expr.Node
+}
+
+func newRenderer(app *application.Application) *renderer {
+	return &renderer{
+		app:   app,
+		sizes: make(map[operation.ID]int),
+		nodes: make(map[operation.ID]expr.Node),
+	}
+}
+
+// render returns the expression tree of the operation. Results of finished sub-operations are
+// rendered as the sub-operations themselves, so the tree doesn't change during calculation.
+func (r *renderer) render(id operation.ID) (expr.Node, error) {
+	if node, ok := r.nodes[id]; ok {
+		return node, nil
+	}
+
+	op, err := r.app.Database.Get(id)
+	if err != nil {
+		return nil, err
+	}
+
+	size := 1
+	args := make([]expr.Node, len(op.Operands))
+	for i, operand := range op.Operands {
+		dep := operand.OperationID
+		if dep == 0 {
+			dep = operand.Origin
+		}
+		if dep == 0 {
+			args[i] = literalNode(op.Mode, operand)
+			size++
+			continue
+		}
+
+		args[i], err = r.render(dep)
+		if err != nil {
+			return nil, err
+		}
+		size += r.sizes[dep]
+	}
+	if size > maxRenderedNodes {
+		return nil, fmt.Errorf("expression is too large to render, it has more than %d nodes", maxRenderedNodes)
+	}
+
+	var node expr.Node
+	switch op.Op {
+	case operation.Negation:
+		node = &expr.UnaryExpr{Op: expr.Sub, X: args[0]}
+	case operation.Not:
+		node = &expr.UnaryExpr{Op: expr.Not, X: args[0]}
+	case operation.PackArray:
+		node = &expr.ListExpr{Elems: args}
+	default:
+		node = &expr.CallExpr{Fun: &expr.Ident{Name: string(op.Op)}, Args: args}
+		for kind, operator := range binaryOperators {
+			if operator == op.Op {
+				node = &expr.BinaryExpr{X: args[0], Op: kind, Y: args[1]}
+			}
+		}
+	}
+
+	r.nodes[id] = node
+	r.sizes[id] = size
+	return node, nil
+}
+
+// literalNode returns the expression of a literal operand. Negative numbers are negations of positive literals.
+func literalNode(mode operation.Mode, x operation.Operand) expr.Node {
+	if x.IsArray() {
+		if a, err := x.Array(mode); err == nil {
+			return arrayNode(mode, a.Shape, a.Elems)
+		}
+	}
+
+	switch {
+	case mode == operation.ModeComplex:
+		c, err := x.Complex()
+		if err == nil && imag(c) != 0 {
+			im := signed(numberNode(strconv.FormatFloat(math.Abs(imag(c)), 'g', -1, 64)+"i"), imag(c) < 0)
+			if real(c) == 0 {
+				return im
+			}
+			return &expr.BinaryExpr{X: floatNode(real(c)), Op: expr.Add, Y: im}
+		}
+		return floatNode(real(c))
+	case x.Exact == "":
+		return floatNode(x.Value)
+	}
+
+	text, negative := strings.CutPrefix(x.Exact, "-")
+	if num, denom, ok := strings.Cut(text, "/"); ok {
+		if d, ok := terminatingDecimal(x); ok {
+			return signed(numberNode(d), negative)
+		}
+		// Fractions like 1/3 can't be written as a single number
+		return signed(&expr.BinaryExpr{X: numberNode(num), Op: expr.Quo, Y: numberNode(denom)}, negative)
+	}
+	return signed(numberNode(text), negative)
+}
+
+// maxDecimalDenomBits limits denominators of fractions rendered in decimal notation, see terminatingDecimal.
+// Literals of expressions have at most 10000 decimal digits, larger fractions are rendered as they are.
+const maxDecimalDenomBits = 1 << 16
+
+// terminatingDecimal returns the absolute value of a fraction in decimal notation, e.g. 0.25 for 1/4,
+// if it has a finite number of digits, i.e. its denominator has no prime factors other than 2 and 5.
+func terminatingDecimal(x operation.Operand) (string, bool) {
+	r, err := x.Rat()
+	if err != nil || r.Denom().BitLen() > maxDecimalDenomBits {
+		return "", false
+	}
+
+	denom := new(big.Int).Set(r.Denom())
+	twos := denom.TrailingZeroBits()
+	denom.Rsh(denom, twos)
+	fives := 0
+	five, rem := big.NewInt(5), new(big.Int)
+	for {
+		q, _ := new(big.Int).QuoRem(denom, five, rem)
+		if rem.Sign() != 0 {
+			break
+		}
+		denom = q
+		fives++
+	}
+	if denom.Cmp(big.NewInt(1)) != 0 {
+		return "", false
+	}
+
+	// num/denom = num * 10^digits / denom * 10^-digits, where the first fraction is an integer
+	digits := max(int(twos), fives)
+	scaled := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)
+	scaled.Mul(scaled, new(big.Int).Abs(r.Num()))
+	scaled.Quo(scaled, r.Denom())
+	d, err := decimal.Parse(fmt.Sprintf("%se-%d", scaled, digits))
+	if err != nil {
+		return "", false
+	}
+	return d.String(), true
+}
+
+// arrayNode returns the array literal of the elements of an array of the shape.
+func arrayNode(mode operation.Mode, shape []int, elems []operation.Operand) expr.Node {
+	list := &expr.ListExpr{Elems: make([]expr.Node, shape[0])}
+	step := len(elems) / shape[0]
+	for i := range list.Elems {
+		if len(shape) > 1 {
+			list.Elems[i] = arrayNode(mode, shape[1:], elems[i*step:(i+1)*step])
+		} else {
+			list.Elems[i] = literalNode(mode, elems[i])
+		}
+	}
+	return list
+}
+
+func floatNode(v float64) expr.Node {
+	switch {
+	case math.IsNaN(v):
+		return &expr.Ident{Name: "NaN"}
+	case math.IsInf(v, 0):
+		return signed(&expr.Ident{Name: "inf"}, v < 0)
+	}
+	return signed(numberNode(strconv.FormatFloat(math.Abs(v), 'g', -1, 64)), math.Signbit(v))
+}
+
+func numberNode(text string) expr.Node {
+	value, _ := strconv.ParseFloat(strings.TrimSuffix(text, "i"), 64)
+	return &expr.NumberLit{Raw: text, Value: value, Imag: strings.HasSuffix(text, "i")}
+}
+
+// signed negates the node if negative is set.
+func signed(node expr.Node, negative bool) expr.Node {
+	if !negative {
+		return node
+	}
+	return &expr.UnaryExpr{Op: expr.Sub, X: node}
+}
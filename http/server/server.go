@@ -4,24 +4,32 @@ import (
 	"context"
 	"log"
 	"math-calc/internal/application"
+	"math-calc/internal/orchestrator"
 	"net"
 	"net/http"
 )
 
 func Run(
 	app *application.Application,
+	orc *orchestrator.Orchestrator,
 ) (func(context.Context) error, error) {
 	mux := http.NewServeMux()
 	mux.HandleFunc("/api/v1/register", userRegister)
 	mux.HandleFunc("/api/v1/login", userLogin)
 	mux.HandleFunc("/api/v1/createExpression", createExpression)
 	mux.HandleFunc("/api/v1/expression/", getExpression)
+	mux.HandleFunc("/api/v1/variables/", variables)
+	mux.HandleFunc("/api/v1/functions/", functions)
+	mux.HandleFunc("/api/v1/derive", derive)
+	mux.HandleFunc("/api/v1/admin/queue", adminQueue)
+	mux.HandleFunc("/api/v1/admin/cache", adminCache)
 
 	srv := &http.Server{
 		Addr:    "0.0.0.0:8081",
 		Handler: loggingMiddleware(app.Logger)(mux),
 		BaseContext: func(listener net.Listener) context.Context {
-			return context.WithValue(context.Background(), "app", app)
+			ctx := context.WithValue(context.Background(), "app", app)
+			return context.WithValue(ctx, "orchestrator", orc)
 		}}
 
 	go func() {
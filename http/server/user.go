@@ -10,6 +10,7 @@ import (
 	"math/rand"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -64,6 +65,25 @@ func checkJWT(tokenString string) (int, error) {
 	return 0, fmt.Errorf("failed to parse claims")
 }
 
+// authenticate checks the bearer token of the request and returns the user ID.
+// If the token is missing or invalid, it writes 401 response and returns false.
+func authenticate(w http.ResponseWriter, r *http.Request) (int, bool) {
+	bearerToken := r.Header.Get("Authorization")
+	if bearerToken == "" {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, "missing Authorization header")
+		return 0, false
+	}
+	bearerToken, _ = strings.CutPrefix(bearerToken, "Bearer ")
+	userId, err := checkJWT(bearerToken)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, "invalid token")
+		return 0, false
+	}
+	return userId, true
+}
+
 func userRegister(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		w.WriteHeader(http.StatusMethodNotAllowed)
@@ -0,0 +1,169 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math-calc/internal/application"
+	"math-calc/internal/db"
+	"math-calc/internal/expr"
+	"math-calc/internal/operation"
+	"net/http"
+	"sort"
+)
+
+type variableInput struct {
+	Value *float64 `json:"value"`
+	// ExpressionID binds the variable to the result of an expression, e.g. `x = #42`.
+	ExpressionID operation.ID `json:"expression_id"`
+}
+
+type variableOutput struct {
+	Name         string       `json:"name"`
+	Value        *float64     `json:"value,omitempty"`
+	ExpressionID operation.ID `json:"expression_id,omitempty"`
+}
+
+// variables handles /api/v1/variables/ and /api/v1/variables/{name}.
+func variables(w http.ResponseWriter, r *http.Request) {
+	userId, ok := authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	app := r.Context().Value("app").(*application.Application)
+	name := r.URL.Path[len("/api/v1/variables/"):]
+
+	switch {
+	case r.Method == http.MethodGet && name == "":
+		listVariables(w, app, userId)
+	case r.Method == http.MethodGet:
+		getVariable(w, app, userId, name)
+	case r.Method == http.MethodPut && name != "":
+		putVariable(w, r, app, userId, name)
+	case r.Method == http.MethodDelete && name != "":
+		deleteVariable(w, app, userId, name)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func newVariableOutput(v db.Variable) variableOutput {
+	out := variableOutput{Name: v.Name, ExpressionID: v.OperationID}
+	if v.OperationID == 0 {
+		value := v.Value
+		out.Value = &value
+	}
+	return out
+}
+
+func listVariables(w http.ResponseWriter, app *application.Application, userId int) {
+	vars, err := app.Database.GetVariables(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to get variables: %s", err)
+		return
+	}
+
+	result := make([]variableOutput, 0, len(vars))
+	for _, v := range vars {
+		result = append(result, newVariableOutput(v))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	data, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		panic(err)
+	}
+	w.Write(data)
+}
+
+func getVariable(w http.ResponseWriter, app *application.Application, userId int, name string) {
+	vars, err := app.Database.GetVariables(userId)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to get variables: %s", err)
+		return
+	}
+
+	v, ok := vars[name]
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "variable not found")
+		return
+	}
+
+	data, err := json.MarshalIndent(newVariableOutput(v), "", "    ")
+	if err != nil {
+		panic(err)
+	}
+	w.Write(data)
+}
+
+func putVariable(w http.ResponseWriter, r *http.Request, app *application.Application, userId int, name string) {
+	tokens, err := expr.Tokenize(name)
+	if err != nil || len(tokens) != 2 || tokens[0].Kind != expr.Name {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "invalid variable name %q", name)
+		return
+	}
+
+	defer r.Body.Close()
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to read request body: %s", err)
+		return
+	}
+
+	input := variableInput{}
+	err = json.Unmarshal(body, &input)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintf(w, "failed to unparse json: %s", err)
+		return
+	}
+
+	v := db.Variable{OwnerID: userId, Name: name}
+	switch {
+	case input.Value != nil && input.ExpressionID == 0:
+		v.Value = *input.Value
+	case input.Value == nil && input.ExpressionID != 0:
+		op, err := app.Database.Get(input.ExpressionID)
+		if err != nil || op.OwnerID != userId {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintln(w, "expression not found")
+			return
+		}
+		v.OperationID = op.Id
+	default:
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, "exactly one of value and expression_id is required")
+		return
+	}
+
+	err = app.Database.SetVariable(v)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintf(w, "failed to save variable: %s", err)
+		return
+	}
+
+	data, err := json.MarshalIndent(newVariableOutput(v), "", "    ")
+	if err != nil {
+		panic(err)
+	}
+	w.Write(data)
+}
+
+func deleteVariable(w http.ResponseWriter, app *application.Application, userId int, name string) {
+	err := app.Database.DeleteVariable(userId, name)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintln(w, "variable not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -10,6 +10,34 @@ type Config struct {
 	GoroutineCount           int    `json:"goroutine_count"`
 	OperationCalculationTime int    `json:"operation_calculation_time"`
 	SqlitePath               string `json:"sqlite_path"`
+	// CacheSize is the number of operation results kept in the cache. The cache is disabled if it is 0.
+	CacheSize int `json:"cache_size"`
+	// CacheTTL is the number of seconds a cached result stays valid. Results don't expire if it is 0.
+	CacheTTL int `json:"cache_ttl"`
+	// SearchInterval is the number of seconds between checks of the database for operations
+	// the orchestrator wasn't notified about, e.g. after a restart. It is 5 if not set.
+	SearchInterval int `json:"search_interval"`
+	// UserWeights are shares of workers of users relative to each other, by username.
+	// Users who are not listed have weight 1.
+	UserWeights map[string]int `json:"user_weights"`
+	// Admins are usernames of users allowed to use /api/v1/admin/ endpoints.
+	Admins []string `json:"admins"`
+	// Limits are the quotas of all users. They can be overridden for a user in the users table.
+	Limits Limits `json:"limits"`
+}
+
+// Limits are quotas of a user. Zero values mean no limit.
+type Limits struct {
+	// ActiveOperations is the number of operations a user may have which are not finished yet.
+	ActiveOperations int `json:"active_operations"`
+	// ExpressionsPerHour is the number of expressions a user may create in any hour.
+	ExpressionsPerHour int `json:"expressions_per_hour"`
+	// ExpressionOperations is the number of operations a single expression may consist of.
+	ExpressionOperations int `json:"expression_operations"`
+	// ExpressionDepth is the length of the longest chain of operations of a single expression.
+	ExpressionDepth int `json:"expression_depth"`
+	// ConcurrentOperations is the number of operations of a user calculated by workers at the same time.
+	ConcurrentOperations int `json:"concurrent_operations"`
 }
 
 func LoadConfig(filename string) (Config, error) {
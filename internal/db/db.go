@@ -33,7 +33,10 @@ func (d *Database) Create(op operation.Operation) (operation.ID, error) {
 	}
 	op.Id = newId
 	op.CreatedTime = time.Now()
-	op.State = operation.StateCreated
+	// Operations of conditional branches wait until the branch is chosen
+	if op.State != operation.StateDeferred {
+		op.State = operation.StateCreated
+	}
 
 	d.storage[newId] = op
 
@@ -67,3 +70,16 @@ func (d *Database) All() (map[operation.ID]operation.Operation, error) {
 
 	return d.storage, nil
 }
+
+func (d *Database) ByState(state operation.State) (map[operation.ID]operation.Operation, error) {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+
+	ops := make(map[operation.ID]operation.Operation)
+	for id, op := range d.storage {
+		if op.State == state {
+			ops[id] = op
+		}
+	}
+	return ops, nil
+}
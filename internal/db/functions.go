@@ -0,0 +1,69 @@
+package db
+
+import "fmt"
+
+// Function is a function defined by a user for use in their expressions.
+type Function struct {
+	OwnerID int
+	Name    string
+	// Definition is the source of the function, e.g. `f(x, y) = x^2 + y`.
+	Definition string
+}
+
+// SetFunction creates the function or replaces the existing one with the same name.
+func (d *SqliteDatabase) SetFunction(f Function) error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	var q = `
+	INSERT OR REPLACE INTO functions (owner_id, name, definition) VALUES (?, ?, ?)
+	`
+	_, err := d.conn.Exec(q, f.OwnerID, f.Name, f.Definition)
+	return err
+}
+
+func (d *SqliteDatabase) GetFunctions(ownerID int) (map[string]Function, error) {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+
+	var q = `
+	SELECT owner_id, name, definition FROM functions WHERE owner_id = ?
+	`
+	rows, err := d.conn.Query(q, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	functions := make(map[string]Function)
+	for rows.Next() {
+		var f Function
+		err := rows.Scan(&f.OwnerID, &f.Name, &f.Definition)
+		if err != nil {
+			return nil, err
+		}
+		functions[f.Name] = f
+	}
+	return functions, rows.Err()
+}
+
+func (d *SqliteDatabase) DeleteFunction(ownerID int, name string) error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	var q = `
+	DELETE FROM functions WHERE owner_id = ? AND name = ?
+	`
+	res, err := d.conn.Exec(q, ownerID, name)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("function %s not found", name)
+	}
+	return nil
+}
@@ -2,7 +2,9 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"math-calc/internal/config"
 	"math-calc/internal/operation"
 	_ "modernc.org/sqlite"
 	"sync"
@@ -32,8 +34,87 @@ CREATE TABLE IF NOT EXISTS operations (
     error TEXT,
     expression TEXT
 );
+
+CREATE TABLE IF NOT EXISTS variables (
+    owner_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    value REAL NOT NULL,
+    operation_id INTEGER NOT NULL,
+    PRIMARY KEY (owner_id, name)
+);
+
+CREATE TABLE IF NOT EXISTS functions (
+    owner_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    definition TEXT NOT NULL,
+    PRIMARY KEY (owner_id, name)
+);
 `
 
+// migrations are applied on top of SCHEMA in order.
+// The number of applied migrations is stored in PRAGMA user_version.
+var migrations = []string{
+	// Operands are stored separately, so operations may have any number of them
+	`
+	CREATE TABLE operation_operands (
+	    operation_id INTEGER NOT NULL,
+	    position INTEGER NOT NULL,
+	    value REAL NOT NULL,
+	    dependency_id INTEGER NOT NULL,
+	    PRIMARY KEY (operation_id, position)
+	);
+
+	INSERT INTO operation_operands (operation_id, position, value, dependency_id)
+	SELECT id, 0, COALESCE("left", 0), COALESCE(left_operation_id, 0) FROM operations;
+
+	INSERT INTO operation_operands (operation_id, position, value, dependency_id)
+	SELECT id, 1, COALESCE("right", 0), COALESCE(right_operation_id, 0) FROM operations
+	WHERE operator NOT IN ('neg', 'sqrt', 'abs', 'exp', 'ln', 'log', 'log2', 'sin', 'cos', 'tan', 'asin', 'acos', 'atan', 'floor', 'ceil', 'round');
+	`,
+	// Variables substituted into the expression, encoded as a JSON object
+	`
+	ALTER TABLE operations ADD COLUMN variables TEXT NOT NULL DEFAULT '';
+	`,
+	// Arithmetic modes: values are additionally stored in a lossless text form
+	`
+	ALTER TABLE operations ADD COLUMN mode TEXT NOT NULL DEFAULT 'float';
+	ALTER TABLE operations ADD COLUMN result_exact TEXT NOT NULL DEFAULT '';
+	ALTER TABLE operation_operands ADD COLUMN exact TEXT NOT NULL DEFAULT '';
+	`,
+	// Settings of the decimal mode
+	`
+	ALTER TABLE operations ADD COLUMN precision INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE operations ADD COLUMN rounding TEXT NOT NULL DEFAULT '';
+	`,
+	// Operations the operands were taken from, so that expressions can be rendered after calculation
+	`
+	ALTER TABLE operation_operands ADD COLUMN origin_id INTEGER NOT NULL DEFAULT 0;
+	`,
+	// The orchestrator looks up operations by state
+	`
+	CREATE INDEX operations_state ON operations (state);
+	`,
+	// Scheduling order of pending operations
+	`
+	ALTER TABLE operations ADD COLUMN priority INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE operations ADD COLUMN critical_path INTEGER NOT NULL DEFAULT 0;
+	`,
+	// Quotas of users overriding config.Config.Limits, NULL means the configured one.
+	// Operations are counted by owner to check them.
+	`
+	ALTER TABLE users ADD COLUMN limit_active_operations INTEGER;
+	ALTER TABLE users ADD COLUMN limit_expressions_per_hour INTEGER;
+	ALTER TABLE users ADD COLUMN limit_expression_operations INTEGER;
+	ALTER TABLE users ADD COLUMN limit_expression_depth INTEGER;
+	ALTER TABLE users ADD COLUMN limit_concurrent_operations INTEGER;
+	CREATE INDEX operations_owner ON operations (owner_id, state);
+	`,
+	// Operations waiting for a dependency are looked up by it
+	`
+	CREATE INDEX operation_operands_dependency ON operation_operands (dependency_id);
+	`,
+}
+
 type SqliteDatabase struct {
 	conn *sql.DB
 	mx   sync.RWMutex
@@ -53,23 +134,129 @@ func NewSqlite(filename string) (*SqliteDatabase, error) {
 		return nil, err
 	}
 
+	err = migrate(db)
+	if err != nil {
+		return nil, err
+	}
+
 	return &SqliteDatabase{
 		conn: db,
 	}, nil
 }
 
+func migrate(db *sql.DB) error {
+	var version int
+	err := db.QueryRow("PRAGMA user_version").Scan(&version)
+	if err != nil {
+		return fmt.Errorf("failed to get schema version: %w", err)
+	}
+
+	for ; version < len(migrations); version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(migrations[version])
+		if err == nil {
+			_, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", version+1))
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migration %d failed: %w", version+1, err)
+		}
+		err = tx.Commit()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+const operationColumns = `id, owner_id, operator, mode, precision, rounding, state, priority, critical_path, created_time, finished_time, result, result_exact, error, expression, variables`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanOperation(row scanner) (operation.Operation, error) {
+	var op operation.Operation
+	createdTime := ""
+	finishedTime := ""
+	variables := ""
+	err := row.Scan(&op.Id, &op.OwnerID, &op.Op, &op.Mode, &op.Precision, &op.Rounding, &op.State, &op.Priority, &op.CriticalPath, &createdTime, &finishedTime, &op.Result, &op.ResultExact, &op.Error, &op.Expression, &variables)
+	if err != nil {
+		return operation.Operation{}, err
+	}
+	if variables != "" {
+		err = json.Unmarshal([]byte(variables), &op.Variables)
+		if err != nil {
+			return operation.Operation{}, fmt.Errorf("failed to decode variables of operation %d: %w", op.Id, err)
+		}
+	}
+	op.CreatedTime, err = time.Parse(time.RFC3339, createdTime)
+	if err != nil {
+		return operation.Operation{}, err
+	}
+	op.FinishedTime, err = time.Parse(time.RFC3339, finishedTime)
+	if err != nil {
+		return operation.Operation{}, err
+	}
+	return op, nil
+}
+
+func encodeVariables(variables map[string]float64) (string, error) {
+	if len(variables) == 0 {
+		return "", nil
+	}
+	data, err := json.Marshal(variables)
+	return string(data), err
+}
+
+// insertOperands replaces operands of the operation with op.Operands.
+func insertOperands(tx *sql.Tx, op operation.Operation) error {
+	_, err := tx.Exec(`DELETE FROM operation_operands WHERE operation_id = ?`, op.Id)
+	if err != nil {
+		return err
+	}
+
+	for i, operand := range op.Operands {
+		_, err = tx.Exec(
+			`INSERT INTO operation_operands (operation_id, position, value, exact, dependency_id, origin_id) VALUES (?, ?, ?, ?, ?, ?)`,
+			op.Id, i, operand.Value, operand.Exact, operand.OperationID, operand.Origin,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (d *SqliteDatabase) Create(op operation.Operation) (operation.ID, error) {
 	d.mx.Lock()
 	defer d.mx.Unlock()
 
 	op.CreatedTime = time.Now()
 	op.FinishedTime = time.Unix(0, 0)
-	op.State = operation.StateCreated
+	// Operations of conditional branches wait until the branch is chosen
+	if op.State != operation.StateDeferred {
+		op.State = operation.StateCreated
+	}
+
+	variables, err := encodeVariables(op.Variables)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
 
 	var q = `
-	INSERT INTO operations (owner_id, operator, state, created_time, finished_time, left, right, left_operation_id, right_operation_id, expression, result, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	INSERT INTO operations (owner_id, operator, mode, precision, rounding, state, priority, critical_path, created_time, finished_time, expression, variables, result, error) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	result, err := d.conn.Exec(q, op.OwnerID, op.Op, op.State, op.CreatedTime.Format(time.RFC3339), op.FinishedTime.Format(time.RFC3339), op.Left, op.Right, op.LeftOperationID, op.RightOperationID, op.Expression, 0, "")
+	result, err := tx.Exec(q, op.OwnerID, op.Op, op.Mode, op.Precision, op.Rounding, op.State, op.Priority, op.CriticalPath, op.CreatedTime.Format(time.RFC3339), op.FinishedTime.Format(time.RFC3339), op.Expression, variables, 0, "")
 	if err != nil {
 		return 0, err
 	}
@@ -78,7 +265,12 @@ func (d *SqliteDatabase) Create(op operation.Operation) (operation.ID, error) {
 		return 0, err
 	}
 	op.Id = operation.ID(id)
-	return operation.ID(id), nil
+
+	err = insertOperands(tx, op)
+	if err != nil {
+		return 0, err
+	}
+	return operation.ID(id), tx.Commit()
 }
 
 func (d *SqliteDatabase) Get(id operation.ID) (operation.Operation, error) {
@@ -86,35 +278,77 @@ func (d *SqliteDatabase) Get(id operation.ID) (operation.Operation, error) {
 	defer d.mx.RUnlock()
 
 	var q = `
-        SELECT * FROM operations WHERE id = ?
+	SELECT ` + operationColumns + ` FROM operations WHERE id = ?
 	`
-	row := d.conn.QueryRow(q, id)
-	var op operation.Operation
-	createdTime := ""
-	finishedTime := ""
-	err := row.Scan(&op.Id, &op.OwnerID, &op.Op, &op.State, &createdTime, &finishedTime, &op.Left, &op.Right, &op.LeftOperationID, &op.RightOperationID, &op.Result, &op.Error, &op.Expression)
+	op, err := scanOperation(d.conn.QueryRow(q, id))
 	if err != nil {
 		return operation.Operation{}, fmt.Errorf("operation with id %d not found", id)
 	}
-	op.CreatedTime, err = time.Parse(time.RFC3339, createdTime)
+
+	q = `
+	SELECT value, exact, dependency_id, origin_id FROM operation_operands WHERE operation_id = ? ORDER BY position
+	`
+	rows, err := d.conn.Query(q, id)
 	if err != nil {
 		return operation.Operation{}, err
 	}
-	op.FinishedTime, err = time.Parse(time.RFC3339, finishedTime)
+	defer rows.Close()
+
+	for rows.Next() {
+		var operand operation.Operand
+		err := rows.Scan(&operand.Value, &operand.Exact, &operand.OperationID, &operand.Origin)
+		if err != nil {
+			return operation.Operation{}, err
+		}
+		op.Operands = append(op.Operands, operand)
+	}
+	return op, rows.Err()
+}
+
+// Dependents returns the ids of operations which have an operand waiting for the result of the operation.
+func (d *SqliteDatabase) Dependents(id operation.ID) ([]operation.ID, error) {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+
+	var q = `
+	SELECT DISTINCT operation_id FROM operation_operands WHERE dependency_id = ?
+	`
+	rows, err := d.conn.Query(q, id)
 	if err != nil {
-		return operation.Operation{}, err
+		return nil, err
 	}
-	return op, nil
+	defer rows.Close()
+
+	var ids []operation.ID
+	for rows.Next() {
+		var dependent operation.ID
+		if err := rows.Scan(&dependent); err != nil {
+			return nil, err
+		}
+		ids = append(ids, dependent)
+	}
+	return ids, rows.Err()
 }
 
 func (d *SqliteDatabase) Update(op operation.Operation) error {
 	d.mx.Lock()
 	defer d.mx.Unlock()
 
+	variables, err := encodeVariables(op.Variables)
+	if err != nil {
+		return err
+	}
+
+	tx, err := d.conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
 	var q = `
-	UPDATE operations SET operator = ?, state = ?, created_time = ?, finished_time = ?, left = ?, right = ?, left_operation_id = ?, right_operation_id = ?, result = ?, error = ?, expression = ? WHERE id = ?
+	UPDATE operations SET operator = ?, mode = ?, precision = ?, rounding = ?, state = ?, priority = ?, critical_path = ?, created_time = ?, finished_time = ?, result = ?, result_exact = ?, error = ?, expression = ?, variables = ? WHERE id = ?
 	`
-	res, err := d.conn.Exec(q, op.Op, op.State, op.CreatedTime.Format(time.RFC3339), op.FinishedTime.Format(time.RFC3339), op.Left, op.Right, op.LeftOperationID, op.RightOperationID, op.Result, op.Error, op.Expression, op.Id)
+	res, err := tx.Exec(q, op.Op, op.Mode, op.Precision, op.Rounding, op.State, op.Priority, op.CriticalPath, op.CreatedTime.Format(time.RFC3339), op.FinishedTime.Format(time.RFC3339), op.Result, op.ResultExact, op.Error, op.Expression, variables, op.Id)
 	if err != nil {
 		return err
 	}
@@ -125,17 +359,35 @@ func (d *SqliteDatabase) Update(op operation.Operation) error {
 	if affected == 0 {
 		return fmt.Errorf("operation with id %d not found", op.Id)
 	}
-	return nil
+
+	err = insertOperands(tx, op)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
 func (d *SqliteDatabase) All() (map[operation.ID]operation.Operation, error) {
 	d.mx.RLock()
 	defer d.mx.RUnlock()
 
+	return d.selectOperations("")
+}
+
+// ByState returns operations in the state. It uses an index, so it doesn't read the whole history.
+func (d *SqliteDatabase) ByState(state operation.State) (map[operation.ID]operation.Operation, error) {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+
+	return d.selectOperations("WHERE state = ?", state)
+}
+
+// selectOperations returns operations matching the WHERE clause, together with their operands.
+func (d *SqliteDatabase) selectOperations(where string, args ...any) (map[operation.ID]operation.Operation, error) {
 	var q = `
-	SELECT * FROM operations
+	SELECT ` + operationColumns + ` FROM operations ` + where + `
 	`
-	rows, err := d.conn.Query(q)
+	rows, err := d.conn.Query(q, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -143,24 +395,43 @@ func (d *SqliteDatabase) All() (map[operation.ID]operation.Operation, error) {
 
 	ops := make(map[operation.ID]operation.Operation)
 	for rows.Next() {
-		var op operation.Operation
-		createdTime := ""
-		finishedTime := ""
-		err := rows.Scan(&op.Id, &op.OwnerID, &op.Op, &op.State, &createdTime, &finishedTime, &op.Left, &op.Right, &op.LeftOperationID, &op.RightOperationID, &op.Result, &op.Error, &op.Expression)
+		op, err := scanOperation(rows)
 		if err != nil {
 			return nil, err
 		}
-		op.CreatedTime, err = time.Parse(time.RFC3339, createdTime)
+		ops[op.Id] = op
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	q = `
+	SELECT operation_id, value, exact, dependency_id, origin_id FROM operation_operands
+	`
+	if where != "" {
+		q += `WHERE operation_id IN (SELECT id FROM operations ` + where + `)
+	`
+	}
+	q += `ORDER BY operation_id, position`
+	operandRows, err := d.conn.Query(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer operandRows.Close()
+
+	for operandRows.Next() {
+		var id operation.ID
+		var operand operation.Operand
+		err := operandRows.Scan(&id, &operand.Value, &operand.Exact, &operand.OperationID, &operand.Origin)
 		if err != nil {
 			return nil, err
 		}
-		op.FinishedTime, err = time.Parse(time.RFC3339, finishedTime)
-		if err != nil {
-			return nil, err
+		if op, ok := ops[id]; ok {
+			op.Operands = append(op.Operands, operand)
+			ops[id] = op
 		}
-		ops[op.Id] = op
 	}
-	return ops, nil
+	return ops, operandRows.Err()
 }
 
 type User struct {
@@ -175,7 +446,7 @@ func (d *SqliteDatabase) GetUserByID(id int) (User, error) {
 	defer d.mx.RUnlock()
 
 	var q = `
-	SELECT * FROM users WHERE id = ?
+	SELECT id, username, password_salt, password_hash FROM users WHERE id = ?
 	`
 	row := d.conn.QueryRow(q, id)
 	var user User
@@ -191,7 +462,7 @@ func (d *SqliteDatabase) GetUserByUsername(username string) (User, error) {
 	defer d.mx.RUnlock()
 
 	var q = `
-	SELECT * FROM users WHERE username = ?
+	SELECT id, username, password_salt, password_hash FROM users WHERE username = ?
 	`
 	row := d.conn.QueryRow(q, username)
 	var user User
@@ -202,6 +473,58 @@ func (d *SqliteDatabase) GetUserByUsername(username string) (User, error) {
 	return user, nil
 }
 
+// GetLimits returns the quotas of the user. Quotas which are not set in the users table are taken from defaults.
+func (d *SqliteDatabase) GetLimits(userId int, defaults config.Limits) (config.Limits, error) {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+
+	var q = `
+	SELECT
+	    COALESCE(limit_active_operations, ?),
+	    COALESCE(limit_expressions_per_hour, ?),
+	    COALESCE(limit_expression_operations, ?),
+	    COALESCE(limit_expression_depth, ?),
+	    COALESCE(limit_concurrent_operations, ?)
+	FROM users WHERE id = ?
+	`
+	row := d.conn.QueryRow(q, defaults.ActiveOperations, defaults.ExpressionsPerHour, defaults.ExpressionOperations,
+		defaults.ExpressionDepth, defaults.ConcurrentOperations, userId)
+	var limits config.Limits
+	err := row.Scan(&limits.ActiveOperations, &limits.ExpressionsPerHour, &limits.ExpressionOperations,
+		&limits.ExpressionDepth, &limits.ConcurrentOperations)
+	if err != nil {
+		return config.Limits{}, fmt.Errorf("user with id %d not found", userId)
+	}
+	return limits, nil
+}
+
+// CountActive returns the number of operations of the user which are neither finished nor skipped.
+func (d *SqliteDatabase) CountActive(userId int) (int, error) {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+
+	var q = `
+	SELECT COUNT(*) FROM operations WHERE owner_id = ? AND state NOT IN (?, ?, ?)
+	`
+	var count int
+	err := d.conn.QueryRow(q, userId, operation.StateDone, operation.StateError, operation.StateSkipped).Scan(&count)
+	return count, err
+}
+
+// CountExpressions returns the number of expressions the user has created since the time.
+func (d *SqliteDatabase) CountExpressions(userId int, since time.Time) (int, error) {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+
+	// Times are stored in the same format and time zone, so they are compared as text
+	var q = `
+	SELECT COUNT(*) FROM operations WHERE owner_id = ? AND expression != '' AND created_time >= ?
+	`
+	var count int
+	err := d.conn.QueryRow(q, userId, since.Format(time.RFC3339)).Scan(&count)
+	return count, err
+}
+
 func (d *SqliteDatabase) CreateUser(username, passwordSalt, passwordHash string) (int, error) {
 	d.mx.Lock()
 	defer d.mx.Unlock()
@@ -0,0 +1,74 @@
+package db
+
+import (
+	"fmt"
+	"math-calc/internal/operation"
+)
+
+// Variable is a named value saved by a user for use in their expressions.
+type Variable struct {
+	OwnerID int
+	Name    string
+	// Value is the value of the variable. It is empty while OperationID is set.
+	Value float64
+	// OperationID is set when the variable is bound to the result of an operation.
+	OperationID operation.ID
+}
+
+// SetVariable creates the variable or replaces the existing one with the same name.
+func (d *SqliteDatabase) SetVariable(v Variable) error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	var q = `
+	INSERT OR REPLACE INTO variables (owner_id, name, value, operation_id) VALUES (?, ?, ?, ?)
+	`
+	_, err := d.conn.Exec(q, v.OwnerID, v.Name, v.Value, v.OperationID)
+	return err
+}
+
+func (d *SqliteDatabase) GetVariables(ownerID int) (map[string]Variable, error) {
+	d.mx.RLock()
+	defer d.mx.RUnlock()
+
+	var q = `
+	SELECT owner_id, name, value, operation_id FROM variables WHERE owner_id = ?
+	`
+	rows, err := d.conn.Query(q, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variables := make(map[string]Variable)
+	for rows.Next() {
+		var v Variable
+		err := rows.Scan(&v.OwnerID, &v.Name, &v.Value, &v.OperationID)
+		if err != nil {
+			return nil, err
+		}
+		variables[v.Name] = v
+	}
+	return variables, rows.Err()
+}
+
+func (d *SqliteDatabase) DeleteVariable(ownerID int, name string) error {
+	d.mx.Lock()
+	defer d.mx.Unlock()
+
+	var q = `
+	DELETE FROM variables WHERE owner_id = ? AND name = ?
+	`
+	res, err := d.conn.Exec(q, ownerID, name)
+	if err != nil {
+		return err
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("variable %s not found", name)
+	}
+	return nil
+}
@@ -0,0 +1,278 @@
+// Package decimal implements arbitrary-precision decimal numbers with explicit rounding.
+package decimal
+
+import (
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var (
+	bigOne = big.NewInt(1)
+	bigTen = big.NewInt(10)
+)
+
+// Decimal is a number equal to coef * 10^exp. The zero value is 0.
+// Decimals are immutable, all operations return new values.
+type Decimal struct {
+	coef *big.Int
+	exp  int
+}
+
+// Parse parses a number in decimal or scientific notation, e.g. "-12.5" or "1.25e-3".
+func Parse(s string) (Decimal, error) {
+	mantissa, exponent := s, 0
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		var err error
+		exponent, err = strconv.Atoi(s[i+1:])
+		if err != nil {
+			return Decimal{}, fmt.Errorf("malformed decimal %q", s)
+		}
+		mantissa = s[:i]
+	}
+
+	intPart, fracPart, _ := strings.Cut(mantissa, ".")
+	digits := intPart + fracPart
+	if digits == "" || digits == "-" || digits == "+" {
+		return Decimal{}, fmt.Errorf("malformed decimal %q", s)
+	}
+
+	coef, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("malformed decimal %q", s)
+	}
+	return Decimal{coef: coef, exp: exponent - len(fracPart)}.reduce(), nil
+}
+
+// FromInt returns the decimal equal to x.
+func FromInt(x *big.Int) Decimal {
+	return Decimal{coef: new(big.Int).Set(x)}.reduce()
+}
+
+func (d Decimal) coefficient() *big.Int {
+	if d.coef == nil {
+		return new(big.Int)
+	}
+	return d.coef
+}
+
+// reduce removes trailing zeros from the coefficient, so every value has a single representation.
+func (d Decimal) reduce() Decimal {
+	coef := d.coefficient()
+	if coef.Sign() == 0 {
+		return Decimal{coef: new(big.Int)}
+	}
+
+	// Dividing by 10 one zero at a time would be quadratic in the length of large numbers
+	digits := coef.String()
+	zeros := len(digits) - len(strings.TrimRight(digits, "0"))
+	if zeros == 0 {
+		return Decimal{coef: new(big.Int).Set(coef), exp: d.exp}
+	}
+	return Decimal{coef: new(big.Int).Quo(coef, pow10(zeros)), exp: d.exp + zeros}
+}
+
+// String returns the number in plain decimal notation.
+func (d Decimal) String() string {
+	coef := d.coefficient()
+	if d.exp >= 0 {
+		return coef.String() + strings.Repeat("0", d.exp)
+	}
+
+	digits := new(big.Int).Abs(coef).String()
+	sign := ""
+	if coef.Sign() < 0 {
+		sign = "-"
+	}
+
+	point := len(digits) + d.exp
+	if point <= 0 {
+		return sign + "0." + strings.Repeat("0", -point) + digits
+	}
+	return sign + digits[:point] + "." + digits[point:]
+}
+
+// Float64 returns the closest float64 value. It is ±Inf if the number is out of float64 range.
+func (d Decimal) Float64() float64 {
+	value, _ := strconv.ParseFloat(d.coefficient().String()+"e"+strconv.Itoa(d.exp), 64)
+	return value
+}
+
+// AdjustedExp returns the exponent of the most significant digit, e.g. 2 for 123.4 and -3 for 0.0012.
+// It is 0 for zero.
+func (d Decimal) AdjustedExp() int {
+	if d.Sign() == 0 {
+		return 0
+	}
+	return d.exp + numDigits(d.coefficient()) - 1
+}
+
+func (d Decimal) Sign() int {
+	return d.coefficient().Sign()
+}
+
+func (d Decimal) Cmp(other Decimal) int {
+	a, b, _ := align(d, other)
+	return a.Cmp(b)
+}
+
+// IsInt reports whether the number has no fractional part.
+func (d Decimal) IsInt() bool {
+	return d.reduce().exp >= 0
+}
+
+// Int returns the integer part of the number, truncating towards zero.
+func (d Decimal) Int() *big.Int {
+	if d.exp >= 0 {
+		return new(big.Int).Mul(d.coefficient(), pow10(d.exp))
+	}
+	return new(big.Int).Quo(d.coefficient(), pow10(-d.exp))
+}
+
+func (d Decimal) Neg() Decimal {
+	return Decimal{coef: new(big.Int).Neg(d.coefficient()), exp: d.exp}
+}
+
+func (d Decimal) Abs() Decimal {
+	return Decimal{coef: new(big.Int).Abs(d.coefficient()), exp: d.exp}
+}
+
+// Add returns the exact sum.
+func (d Decimal) Add(other Decimal) Decimal {
+	a, b, exp := align(d, other)
+	return Decimal{coef: a.Add(a, b), exp: exp}.reduce()
+}
+
+// Sub returns the exact difference.
+func (d Decimal) Sub(other Decimal) Decimal {
+	return d.Add(other.Neg())
+}
+
+// Mul returns the exact product.
+func (d Decimal) Mul(other Decimal) Decimal {
+	return Decimal{coef: new(big.Int).Mul(d.coefficient(), other.coefficient()), exp: d.exp + other.exp}.reduce()
+}
+
+// Quo returns the quotient rounded to prec significant digits. The divisor must not be zero.
+func (d Decimal) Quo(other Decimal, prec int, mode RoundingMode) Decimal {
+	num, den := d.coefficient(), other.coefficient()
+
+	// Scaling the dividend, so the quotient has at least prec+1 digits
+	shift := prec + 1 + numDigits(den) - numDigits(num)
+	if shift < 0 {
+		shift = 0
+	}
+	num = new(big.Int).Mul(num, pow10(shift))
+
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	return roundSticky(q, d.exp-other.exp-shift, r.Sign() != 0, prec, mode)
+}
+
+// FloorQuo returns the largest integer not greater than the quotient. The divisor must not be zero.
+func (d Decimal) FloorQuo(other Decimal) Decimal {
+	a, b, _ := align(d, other)
+	q, r := new(big.Int).QuoRem(a, b, new(big.Int))
+	if r.Sign() != 0 && (r.Sign() < 0) != (b.Sign() < 0) {
+		q.Sub(q, bigOne)
+	}
+	return FromInt(q)
+}
+
+// Floor returns the largest integer not greater than the number.
+func (d Decimal) Floor() Decimal {
+	return d.FloorQuo(Decimal{coef: big.NewInt(1)})
+}
+
+// Ceil returns the smallest integer not less than the number.
+func (d Decimal) Ceil() Decimal {
+	return d.Neg().Floor().Neg()
+}
+
+// Sqrt returns the square root rounded to prec significant digits. The number must not be negative.
+func (d Decimal) Sqrt(prec int, mode RoundingMode) Decimal {
+	coef, exp := d.coefficient(), d.exp
+
+	// The exponent has to be even and the coefficient long enough for prec+1 digits of the root
+	shift := 2*(prec+1) - numDigits(coef)
+	if shift < 0 {
+		shift = 0
+	}
+	if (exp-shift)%2 != 0 {
+		shift++
+	}
+	coef = new(big.Int).Mul(coef, pow10(shift))
+	exp -= shift
+
+	root := new(big.Int).Sqrt(coef)
+	exact := new(big.Int).Mul(root, root).Cmp(coef) == 0
+	return roundSticky(root, exp/2, !exact, prec, mode)
+}
+
+// Round rounds the number to prec significant digits.
+func (d Decimal) Round(prec int, mode RoundingMode) Decimal {
+	return roundSticky(d.coefficient(), d.exp, false, prec, mode)
+}
+
+// RoundToInt rounds the number to an integer.
+func (d Decimal) RoundToInt(mode RoundingMode) Decimal {
+	if d.exp >= 0 {
+		return d
+	}
+	return dropDigits(d.coefficient(), d.exp, -d.exp, mode)
+}
+
+// roundSticky rounds coef*10^exp to prec significant digits.
+// sticky means that the exact value is slightly greater in magnitude than coef*10^exp.
+func roundSticky(coef *big.Int, exp int, sticky bool, prec int, mode RoundingMode) Decimal {
+	coef = new(big.Int).Set(coef)
+	if sticky {
+		// Appending a non-zero digit keeps ties and exact values distinguishable
+		coef.Mul(coef, bigTen)
+		if coef.Sign() < 0 {
+			coef.Sub(coef, bigOne)
+		} else {
+			coef.Add(coef, bigOne)
+		}
+		exp--
+	}
+
+	drop := numDigits(coef) - prec
+	if drop <= 0 {
+		return Decimal{coef: coef, exp: exp}.reduce()
+	}
+	return dropDigits(coef, exp, drop, mode)
+}
+
+// dropDigits removes n last digits of coef*10^exp, rounding the rest according to mode.
+func dropDigits(coef *big.Int, exp, n int, mode RoundingMode) Decimal {
+	neg := coef.Sign() < 0
+	divisor := pow10(n)
+	q, r := new(big.Int).QuoRem(new(big.Int).Abs(coef), divisor, new(big.Int))
+	if mode.roundsAway(q, r, divisor, neg) {
+		q.Add(q, bigOne)
+	}
+	if neg {
+		q.Neg(q)
+	}
+	return Decimal{coef: q, exp: exp + n}.reduce()
+}
+
+// align returns coefficients of both numbers scaled to the same exponent.
+func align(a, b Decimal) (*big.Int, *big.Int, int) {
+	exp := min(a.exp, b.exp)
+	ca := new(big.Int).Mul(a.coefficient(), pow10(a.exp-exp))
+	cb := new(big.Int).Mul(b.coefficient(), pow10(b.exp-exp))
+	return ca, cb, exp
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+func numDigits(x *big.Int) int {
+	if x.Sign() == 0 {
+		return 1
+	}
+	return len(new(big.Int).Abs(x).String())
+}
@@ -0,0 +1,216 @@
+package decimal
+
+import (
+	"math/big"
+	"testing"
+)
+
+func mustParse(t *testing.T, s string) Decimal {
+	t.Helper()
+	d, err := Parse(s)
+	if err != nil {
+		t.Fatalf("Parse(%q) returned error: %s", s, err)
+	}
+	return d
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"0", "0"},
+		{"-0.0", "0"},
+		{"12.50", "12.5"},
+		{".5", "0.5"},
+		{"5.", "5"},
+		{"1.25e-3", "0.00125"},
+		{"1.5E3", "1500"},
+		{"-007", "-7"},
+	}
+	for _, tt := range tests {
+		if got := mustParse(t, tt.input).String(); got != tt.want {
+			t.Errorf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+		}
+	}
+
+	for _, input := range []string{"", "-", ".", "1e", "1e+", "abc", "1.2.3"} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) returned no error", input)
+		}
+	}
+}
+
+func TestAdjustedExp(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"0", 0},
+		{"7", 0},
+		{"123.4", 2},
+		{"-123.4", 2},
+		{"0.0012", -3},
+		{"1000", 3},
+		{"9.99e100", 100},
+		{"1e-100", -100},
+	}
+	for _, tt := range tests {
+		if got := mustParse(t, tt.input).AdjustedExp(); got != tt.want {
+			t.Errorf("Parse(%q).AdjustedExp() = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		input string
+		prec  int
+		mode  RoundingMode
+		want  string
+	}{
+		{"2.5", 1, HalfEven, "2"},
+		{"3.5", 1, HalfEven, "4"},
+		{"-2.5", 1, HalfEven, "-2"},
+		{"2.5", 1, HalfUp, "3"},
+		{"-2.5", 1, HalfUp, "-3"},
+		{"2.5", 1, HalfDown, "2"},
+		{"2.51", 1, HalfDown, "3"},
+		{"2.1", 1, Up, "3"},
+		{"-2.1", 1, Up, "-3"},
+		{"2.9", 1, Down, "2"},
+		{"-2.9", 1, Down, "-2"},
+		{"2.1", 1, Ceiling, "3"},
+		{"-2.9", 1, Ceiling, "-2"},
+		{"2.9", 1, Floor, "2"},
+		{"-2.1", 1, Floor, "-3"},
+		{"123456", 3, HalfEven, "123000"},
+		{"0.0012345", 3, HalfEven, "0.00123"},
+		{"9.99", 2, HalfUp, "10"},
+		{"1.5", 5, HalfEven, "1.5"},
+	}
+	for _, tt := range tests {
+		got := mustParse(t, tt.input).Round(tt.prec, tt.mode).String()
+		if got != tt.want {
+			t.Errorf("Round(%s, %d, %s) = %s, want %s", tt.input, tt.prec, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestRoundToInt(t *testing.T) {
+	tests := []struct {
+		input string
+		mode  RoundingMode
+		want  string
+	}{
+		{"0.5", HalfEven, "0"},
+		{"1.5", HalfEven, "2"},
+		{"-1.5", HalfUp, "-2"},
+		{"0.001", Up, "1"},
+		{"-0.001", Floor, "-1"},
+		{"-0.999", Down, "0"},
+		{"1200", HalfEven, "1200"},
+	}
+	for _, tt := range tests {
+		got := mustParse(t, tt.input).RoundToInt(tt.mode).String()
+		if got != tt.want {
+			t.Errorf("RoundToInt(%s, %s) = %s, want %s", tt.input, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestQuo(t *testing.T) {
+	tests := []struct {
+		x, y string
+		prec int
+		mode RoundingMode
+		want string
+	}{
+		{"1", "3", 5, HalfEven, "0.33333"},
+		{"2", "3", 5, HalfEven, "0.66667"},
+		{"2", "3", 5, Down, "0.66666"},
+		{"-2", "3", 5, Floor, "-0.66667"},
+		{"1", "8", 2, HalfEven, "0.12"},
+		{"3", "8", 2, HalfEven, "0.38"},
+		// The remainder beyond the precision breaks the tie
+		{"1.2500001", "10", 2, HalfEven, "0.13"},
+		{"1", "4", 34, HalfEven, "0.25"},
+		{"100", "0.01", 3, HalfEven, "10000"},
+		{"1e-20", "3", 3, HalfEven, "0.00000000000000000000333"},
+		{"123456789", "1", 3, HalfUp, "123000000"},
+	}
+	for _, tt := range tests {
+		got := mustParse(t, tt.x).Quo(mustParse(t, tt.y), tt.prec, tt.mode).String()
+		if got != tt.want {
+			t.Errorf("Quo(%s, %s, %d, %s) = %s, want %s", tt.x, tt.y, tt.prec, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestSqrt(t *testing.T) {
+	tests := []struct {
+		input string
+		prec  int
+		mode  RoundingMode
+		want  string
+	}{
+		{"4", 10, HalfEven, "2"},
+		{"0.25", 10, HalfEven, "0.5"},
+		{"2", 10, HalfEven, "1.414213562"},
+		{"2", 10, Up, "1.414213563"},
+		{"2", 5, HalfEven, "1.4142"},
+		{"1e-10", 3, HalfEven, "0.00001"},
+		{"1e3", 4, HalfEven, "31.62"},
+		{"0", 5, HalfEven, "0"},
+	}
+	for _, tt := range tests {
+		got := mustParse(t, tt.input).Sqrt(tt.prec, tt.mode).String()
+		if got != tt.want {
+			t.Errorf("Sqrt(%s, %d, %s) = %s, want %s", tt.input, tt.prec, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestFloorQuo(t *testing.T) {
+	tests := []struct {
+		x, y string
+		want string
+	}{
+		{"7", "2", "3"},
+		{"-7", "2", "-4"},
+		{"7", "-2", "-4"},
+		{"-7", "-2", "3"},
+		{"7.5", "2.5", "3"},
+		{"0.1", "0.03", "3"},
+	}
+	for _, tt := range tests {
+		got := mustParse(t, tt.x).FloorQuo(mustParse(t, tt.y)).String()
+		if got != tt.want {
+			t.Errorf("FloorQuo(%s, %s) = %s, want %s", tt.x, tt.y, got, tt.want)
+		}
+	}
+}
+
+func TestQuoInt(t *testing.T) {
+	tests := []struct {
+		x, y int64
+		mode RoundingMode
+		want int64
+	}{
+		{7, 2, HalfEven, 4},
+		{5, 2, HalfEven, 2},
+		{-5, 2, HalfEven, -2},
+		{-5, 2, HalfUp, -3},
+		{-7, 2, Floor, -4},
+		{-7, 2, Ceiling, -3},
+		{7, -2, Down, -3},
+		{1, 3, Up, 1},
+		{6, 3, Up, 2},
+	}
+	for _, tt := range tests {
+		got := QuoInt(big.NewInt(tt.x), big.NewInt(tt.y), tt.mode)
+		if got.Int64() != tt.want {
+			t.Errorf("QuoInt(%d, %d, %s) = %s, want %d", tt.x, tt.y, tt.mode, got, tt.want)
+		}
+	}
+}
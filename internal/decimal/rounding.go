@@ -0,0 +1,83 @@
+package decimal
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// RoundingMode specifies how digits beyond the precision are discarded.
+type RoundingMode string
+
+const (
+	// HalfEven rounds to the nearest neighbour, ties to the even one. Also known as banker's rounding.
+	HalfEven RoundingMode = "half_even"
+	// HalfUp rounds to the nearest neighbour, ties away from zero.
+	HalfUp RoundingMode = "half_up"
+	// HalfDown rounds to the nearest neighbour, ties towards zero.
+	HalfDown RoundingMode = "half_down"
+	// Up rounds away from zero.
+	Up RoundingMode = "up"
+	// Down rounds towards zero, i.e. truncates.
+	Down RoundingMode = "down"
+	// Ceiling rounds towards positive infinity.
+	Ceiling RoundingMode = "ceiling"
+	// Floor rounds towards negative infinity.
+	Floor RoundingMode = "floor"
+)
+
+// ParseRoundingMode returns the rounding mode with the given name. Empty name stands for HalfEven.
+func ParseRoundingMode(name string) (RoundingMode, error) {
+	switch mode := RoundingMode(name); mode {
+	case "":
+		return HalfEven, nil
+	case HalfEven, HalfUp, HalfDown, Up, Down, Ceiling, Floor:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown rounding mode %q", name)
+}
+
+// QuoInt returns x/y rounded to an integer according to mode. The divisor must not be zero.
+func QuoInt(x, y *big.Int, mode RoundingMode) *big.Int {
+	neg := (x.Sign() < 0) != (y.Sign() < 0)
+	divisor := new(big.Int).Abs(y)
+	q, r := new(big.Int).QuoRem(new(big.Int).Abs(x), divisor, new(big.Int))
+	if mode.roundsAway(q, r, divisor, neg) {
+		q.Add(q, bigOne)
+	}
+	if neg {
+		q.Neg(q)
+	}
+	return q
+}
+
+// roundsAway reports whether the truncated magnitude q has to be incremented,
+// given the discarded remainder r out of divisor.
+func (m RoundingMode) roundsAway(q, r, divisor *big.Int, neg bool) bool {
+	if r.Sign() == 0 {
+		return false
+	}
+
+	switch m {
+	case Up:
+		return true
+	case Down:
+		return false
+	case Ceiling:
+		return !neg
+	case Floor:
+		return neg
+	}
+
+	half := new(big.Int).Lsh(r, 1).Cmp(divisor)
+	switch {
+	case half > 0:
+		return true
+	case half < 0:
+		return false
+	case m == HalfUp:
+		return true
+	case m == HalfDown:
+		return false
+	}
+	return q.Bit(0) == 1
+}
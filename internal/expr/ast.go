@@ -0,0 +1,79 @@
+package expr
+
+// Node is a node of the expression tree.
+type Node interface {
+	// Pos returns the column of the first character of the node.
+	Pos() int
+	// End returns the column right after the last character of the node.
+	End() int
+}
+
+// NumberLit is a numeric literal.
+type NumberLit struct {
+	ValuePos int
+	// Raw is the literal as it was written in the source.
+	Raw string
+	// Value is the value of the literal. For imaginary literals it is the imaginary part.
+	Value float64
+	// Imag is set for imaginary literals, e.g. 4i.
+	Imag bool
+}
+
+// Ident is a name, e.g. a function name.
+type Ident struct {
+	NamePos int
+	Name    string
+}
+
+// CallExpr is a function call, e.g. `max(1, 2)`.
+type CallExpr struct {
+	Fun    *Ident
+	Lparen int
+	Args   []Node
+	Rparen int
+}
+
+// BinaryExpr is an infix operation, e.g. `2 + 3`.
+type BinaryExpr struct {
+	X     Node
+	Op    Kind
+	OpPos int
+	Y     Node
+}
+
+// UnaryExpr is a prefix operation, e.g. `-x`.
+type UnaryExpr struct {
+	Op    Kind
+	OpPos int
+	X     Node
+}
+
+// ParenExpr is a parenthesized expression.
+type ParenExpr struct {
+	Lparen int
+	X      Node
+	Rparen int
+}
+
+// ListExpr is an array literal, e.g. `[1, 2, 3]`. Matrices are lists of rows, e.g. `[[1, 2], [3, 4]]`.
+type ListExpr struct {
+	Lbrack int
+	Elems  []Node
+	Rbrack int
+}
+
+func (n *NumberLit) Pos() int  { return n.ValuePos }
+func (n *Ident) Pos() int      { return n.NamePos }
+func (n *CallExpr) Pos() int   { return n.Fun.Pos() }
+func (n *BinaryExpr) Pos() int { return n.X.Pos() }
+func (n *UnaryExpr) Pos() int  { return n.OpPos }
+func (n *ParenExpr) Pos() int  { return n.Lparen }
+func (n *ListExpr) Pos() int   { return n.Lbrack }
+
+func (n *NumberLit) End() int  { return n.ValuePos + len([]rune(n.Raw)) }
+func (n *Ident) End() int      { return n.NamePos + len([]rune(n.Name)) }
+func (n *CallExpr) End() int   { return n.Rparen + 1 }
+func (n *BinaryExpr) End() int { return n.Y.End() }
+func (n *UnaryExpr) End() int  { return n.X.End() }
+func (n *ParenExpr) End() int  { return n.Rparen + 1 }
+func (n *ListExpr) End() int   { return n.Rbrack + 1 }
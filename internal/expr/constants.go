@@ -0,0 +1,11 @@
+package expr
+
+import "math"
+
+// Constants are names that can be used in any expression.
+var Constants = map[string]float64{
+	"pi":  math.Pi,
+	"e":   math.E,
+	"tau": 2 * math.Pi,
+	"phi": math.Phi,
+}
@@ -0,0 +1,60 @@
+package expr
+
+// Definition is a user-defined function, e.g. `f(x, y) = x^2 + y`.
+type Definition struct {
+	Name   *Ident
+	Params []*Ident
+	Body   Node
+}
+
+// ParseDefinition parses a function definition.
+// Returned errors are of type *Error and point at the offending token.
+func ParseDefinition(input string) (*Definition, error) {
+	tokens, err := Tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+
+	tok := p.next()
+	if tok.Kind != Name {
+		return nil, p.errorf(tok, "expected function name, found %s", describe(tok))
+	}
+	def := &Definition{Name: &Ident{NamePos: tok.Pos, Name: tok.Text}}
+
+	tok = p.next()
+	if tok.Kind != LParen {
+		return nil, p.errorf(tok, "expected ( after function name, found %s", describe(tok))
+	}
+	for p.peek().Kind != RParen {
+		if len(def.Params) > 0 {
+			tok = p.next()
+			if tok.Kind != Comma {
+				return nil, p.errorf(tok, "expected , or ) in parameters of %s, found %s", def.Name.Name, describe(tok))
+			}
+		}
+		tok = p.next()
+		if tok.Kind != Name {
+			return nil, p.errorf(tok, "expected parameter name, found %s", describe(tok))
+		}
+		def.Params = append(def.Params, &Ident{NamePos: tok.Pos, Name: tok.Text})
+	}
+	p.next()
+
+	tok = p.next()
+	if tok.Kind != Assign {
+		return nil, p.errorf(tok, "expected = after parameters of %s, found %s", def.Name.Name, describe(tok))
+	}
+	if p.peek().Kind == EOF {
+		return nil, p.errorf(p.peek(), "function body is empty")
+	}
+
+	def.Body, err = p.parseBinary(1)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.Kind != EOF {
+		return nil, p.errorf(tok, "unexpected %s", describe(tok))
+	}
+	return def, nil
+}
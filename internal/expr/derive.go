@@ -0,0 +1,399 @@
+package expr
+
+import (
+	"math"
+	"strconv"
+)
+
+// Derive returns the derivative of the tree with respect to the variable.
+// Other names are considered to be independent of the variable, and user-defined functions
+// have to be expanded beforehand. The result is simplified, e.g. `x*1 + 0` becomes `x`.
+// Returned errors are of type *Error and point at the part which can't be differentiated.
+func Derive(node Node, variable string) (Node, error) {
+	// Derivatives of constant arrays would be numbers, changing the shape of the result
+	var array Node
+	Inspect(node, func(n Node) bool {
+		if binary, ok := n.(*BinaryExpr); ok && binary.Op == Dot || isList(n) {
+			array = n
+		}
+		return array == nil
+	})
+	if array != nil {
+		return nil, Errorf(array, "arrays can't be differentiated")
+	}
+	return derive(node, variable)
+}
+
+func isList(node Node) bool {
+	_, ok := node.(*ListExpr)
+	return ok
+}
+
+func derive(node Node, variable string) (Node, error) {
+	if !dependsOn(node, variable) {
+		return number(0), nil
+	}
+
+	switch n := node.(type) {
+	case *Ident:
+		return number(1), nil
+	case *ParenExpr:
+		return derive(n.X, variable)
+	case *UnaryExpr:
+		dx, err := derive(n.X, variable)
+		if err != nil {
+			return nil, err
+		}
+		switch n.Op {
+		case Add:
+			return dx, nil
+		case Sub:
+			return negate(dx), nil
+		}
+		return nil, Errorf(n, "operator %s is not differentiable", n.Op)
+	case *BinaryExpr:
+		return deriveBinary(n, variable)
+	case *CallExpr:
+		return deriveCall(n, variable)
+	}
+	return nil, Errorf(node, "%s is not differentiable", Format(node))
+}
+
+func deriveBinary(n *BinaryExpr, variable string) (Node, error) {
+	f, g := n.X, n.Y
+	df, err := derive(f, variable)
+	if err != nil {
+		return nil, err
+	}
+	dg, err := derive(g, variable)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Op {
+	case Add:
+		return add(df, dg), nil
+	case Sub:
+		return subtract(df, dg), nil
+	case Mul:
+		return add(multiply(df, g), multiply(f, dg)), nil
+	case Quo:
+		if !dependsOn(g, variable) {
+			return divide(df, g), nil
+		}
+		return divide(subtract(multiply(df, g), multiply(f, dg)), power(g, number(2))), nil
+	case Pow:
+		switch {
+		case !dependsOn(g, variable):
+			// (f^c)' = c * f^(c-1) * f'
+			return multiply(multiply(g, power(f, subtract(g, number(1)))), df), nil
+		case !dependsOn(f, variable):
+			// (c^g)' = c^g * ln(c) * g'
+			return multiply(multiply(power(f, g), call("ln", f)), dg), nil
+		}
+		// (f^g)' = f^g * (g' * ln(f) + g * f' / f)
+		return multiply(power(f, g), add(multiply(dg, call("ln", f)), divide(multiply(g, df), f))), nil
+	}
+	return nil, Errorf(n, "operator %s is not differentiable", n.Op)
+}
+
+func deriveCall(n *CallExpr, variable string) (Node, error) {
+	// The condition only chooses the piece, it doesn't change the slope
+	if n.Fun.Name == "if" && len(n.Args) == 3 {
+		args, err := deriveAll(n.Args[1:], variable)
+		if err != nil {
+			return nil, err
+		}
+		return call("if", n.Args[0], args[0], args[1]), nil
+	}
+
+	args, err := deriveAll(n.Args, variable)
+	if err != nil {
+		return nil, err
+	}
+
+	switch n.Fun.Name {
+	case "sum":
+		result := number(0)
+		for _, arg := range args {
+			result = add(result, arg)
+		}
+		return result, nil
+	case "avg":
+		result := number(0)
+		for _, arg := range args {
+			result = add(result, arg)
+		}
+		return divide(result, number(float64(len(args)))), nil
+	case "min", "max":
+		return deriveExtremum(n, args), nil
+	case "atan2":
+		if len(n.Args) != 2 {
+			break
+		}
+		// atan2(y, x)' = (x * y' - y * x') / (x^2 + y^2)
+		y, x := n.Args[0], n.Args[1]
+		dy, dx := args[0], args[1]
+		return divide(subtract(multiply(x, dy), multiply(y, dx)), add(power(x, number(2)), power(y, number(2)))), nil
+	}
+
+	if len(n.Args) != 1 {
+		return nil, Errorf(n, "function %s is not differentiable", n.Fun.Name)
+	}
+	u, du := n.Args[0], args[0]
+
+	var outer Node
+	switch n.Fun.Name {
+	case "sqrt":
+		outer = divide(number(1), multiply(number(2), call("sqrt", u)))
+	case "exp":
+		outer = call("exp", u)
+	case "ln":
+		outer = divide(number(1), u)
+	case "log":
+		outer = divide(number(1), multiply(u, call("ln", number(10))))
+	case "log2":
+		outer = divide(number(1), multiply(u, call("ln", number(2))))
+	case "sin":
+		outer = call("cos", u)
+	case "cos":
+		outer = negate(call("sin", u))
+	case "tan":
+		outer = divide(number(1), power(call("cos", u), number(2)))
+	case "asin":
+		outer = divide(number(1), call("sqrt", subtract(number(1), power(u, number(2)))))
+	case "acos":
+		outer = negate(divide(number(1), call("sqrt", subtract(number(1), power(u, number(2))))))
+	case "atan":
+		outer = divide(number(1), add(number(1), power(u, number(2))))
+	case "abs":
+		outer = divide(u, call("abs", u))
+	default:
+		return nil, Errorf(n, "function %s is not differentiable", n.Fun.Name)
+	}
+	// Chain rule
+	return multiply(outer, du), nil
+}
+
+// deriveExtremum differentiates min or max piecewise: the derivative is the one of the chosen argument.
+func deriveExtremum(n *CallExpr, args []Node) Node {
+	if len(n.Args) == 1 {
+		return args[0]
+	}
+
+	// min(a, b, c) = min(a, min(b, c))
+	rest := &CallExpr{Fun: n.Fun, Args: n.Args[1:]}
+	var restNode Node = rest
+	if len(rest.Args) == 1 {
+		restNode = rest.Args[0]
+	}
+	cmp := Leq
+	if n.Fun.Name == "max" {
+		cmp = Geq
+	}
+	cond := &BinaryExpr{X: n.Args[0], Op: cmp, Y: restNode}
+	return call("if", cond, args[0], deriveExtremum(rest, args[1:]))
+}
+
+// deriveAll returns derivatives of the nodes.
+func deriveAll(nodes []Node, variable string) ([]Node, error) {
+	result := make([]Node, len(nodes))
+	for i, node := range nodes {
+		var err error
+		result[i], err = derive(node, variable)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// dependsOn reports whether the tree refers to the variable.
+func dependsOn(node Node, variable string) bool {
+	found := false
+	Inspect(node, func(n Node) bool {
+		if ident, ok := n.(*Ident); ok && ident.Name == variable {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// Following constructors build nodes of derivatives, simplifying them on the way.
+
+func number(v float64) Node {
+	if v < 0 || math.Signbit(v) && v == 0 {
+		return negate(number(-v))
+	}
+	return &NumberLit{Raw: strconv.FormatFloat(v, 'g', -1, 64), Value: v}
+}
+
+// numberValue returns the value of a real literal, possibly negated or parenthesized.
+func numberValue(node Node) (float64, bool) {
+	switch n := node.(type) {
+	case *NumberLit:
+		return n.Value, !n.Imag && !math.IsInf(n.Value, 0)
+	case *ParenExpr:
+		return numberValue(n.X)
+	case *UnaryExpr:
+		v, ok := numberValue(n.X)
+		if n.Op == Sub {
+			v = -v
+		}
+		return v, ok && n.Op != Not
+	}
+	return 0, false
+}
+
+// negated returns x if the node is -x.
+func negated(node Node) (Node, bool) {
+	switch n := node.(type) {
+	case *ParenExpr:
+		return negated(n.X)
+	case *UnaryExpr:
+		if n.Op == Sub {
+			return n.X, true
+		}
+	}
+	return nil, false
+}
+
+// foldable reports whether the result of folding literals can be written as a literal without losing precision.
+func foldable(v float64) bool {
+	return !math.IsInf(v, 0) && !math.IsNaN(v) && v == math.Trunc(v) && math.Abs(v) < 1<<53
+}
+
+func negate(x Node) Node {
+	if v, ok := numberValue(x); ok {
+		if v == 0 {
+			return number(0)
+		}
+		if v < 0 {
+			return number(-v)
+		}
+	}
+	if inner, ok := negated(x); ok {
+		return inner
+	}
+	return &UnaryExpr{Op: Sub, X: x}
+}
+
+func add(x, y Node) Node {
+	a, aok := numberValue(x)
+	b, bok := numberValue(y)
+	switch {
+	case aok && bok && foldable(a) && foldable(b) && foldable(a+b):
+		return number(a + b)
+	case aok && a == 0:
+		return y
+	case bok && b == 0:
+		return x
+	}
+	if inner, ok := negated(y); ok {
+		return subtract(x, inner)
+	}
+	if inner, ok := negated(x); ok {
+		return subtract(y, inner)
+	}
+	if Format(x) == Format(y) {
+		return multiply(number(2), x)
+	}
+	return &BinaryExpr{X: x, Op: Add, Y: y}
+}
+
+func subtract(x, y Node) Node {
+	a, aok := numberValue(x)
+	b, bok := numberValue(y)
+	switch {
+	case aok && bok && foldable(a) && foldable(b) && foldable(a-b):
+		return number(a - b)
+	case bok && b == 0:
+		return x
+	case aok && a == 0:
+		return negate(y)
+	}
+	if inner, ok := negated(y); ok {
+		return add(x, inner)
+	}
+	if Format(x) == Format(y) {
+		return number(0)
+	}
+	return &BinaryExpr{X: x, Op: Sub, Y: y}
+}
+
+func multiply(x, y Node) Node {
+	a, aok := numberValue(x)
+	b, bok := numberValue(y)
+	switch {
+	case aok && bok && foldable(a) && foldable(b) && foldable(a*b):
+		return number(a * b)
+	case aok && a == 0, bok && b == 0:
+		return number(0)
+	case aok && a == 1:
+		return y
+	case bok && b == 1:
+		return x
+	case aok && a == -1:
+		return negate(y)
+	case bok && b == -1:
+		return negate(x)
+	}
+	if inner, ok := negated(x); ok {
+		return negate(multiply(inner, y))
+	}
+	if inner, ok := negated(y); ok {
+		return negate(multiply(x, inner))
+	}
+	// Constant factors go first, so that they can be combined
+	if bok && !aok {
+		return multiply(y, x)
+	}
+	if product, ok := y.(*BinaryExpr); ok && aok && product.Op == Mul {
+		if c, ok := numberValue(product.X); ok && foldable(a) && foldable(c) && foldable(a*c) {
+			return multiply(number(a*c), product.Y)
+		}
+	}
+	return &BinaryExpr{X: x, Op: Mul, Y: y}
+}
+
+func divide(x, y Node) Node {
+	a, aok := numberValue(x)
+	b, bok := numberValue(y)
+	switch {
+	case aok && bok && b != 0 && foldable(a) && foldable(b) && foldable(a/b):
+		return number(a / b)
+	case aok && a == 0 && !(bok && b == 0):
+		return number(0)
+	case bok && b == 1:
+		return x
+	case bok && b == -1:
+		return negate(x)
+	}
+	if Format(x) == Format(y) {
+		return number(1)
+	}
+	if inner, ok := negated(x); ok {
+		return negate(divide(inner, y))
+	}
+	if inner, ok := negated(y); ok {
+		return negate(divide(x, inner))
+	}
+	return &BinaryExpr{X: x, Op: Quo, Y: y}
+}
+
+func power(x, y Node) Node {
+	a, aok := numberValue(x)
+	b, bok := numberValue(y)
+	switch {
+	case aok && bok && b >= 0 && foldable(a) && foldable(b) && foldable(math.Pow(a, b)):
+		return number(math.Pow(a, b))
+	case bok && b == 1:
+		return x
+	}
+	return &BinaryExpr{X: x, Op: Pow, Y: y}
+}
+
+func call(name string, args ...Node) Node {
+	return &CallExpr{Fun: &Ident{Name: name}, Args: args}
+}
@@ -0,0 +1,72 @@
+package expr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestDerive(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"5", "0"},
+		{"y", "0"},
+		{"x", "1"},
+		{"-x", "-1"},
+		{"3*x + 1", "3"},
+		{"x*y", "y"},
+		{"x^2", "2 * x"},
+		{"1/x", "-(1 / x^2)"},
+		{"x/y", "1 / y"},
+		{"y/x", "-(y / x^2)"},
+		{"x/x", "0"},
+		{"(x + 1)/(x + 1)", "0"},
+		{"x/0", "1 / 0"},
+		{"x^x", "x^x * (ln(x) + 1)"},
+		{"sin(x)", "cos(x)"},
+		{"exp(2*x)", "2 * exp(2 * x)"},
+		{"ln(x)", "1 / x"},
+		{"sqrt(x)", "1 / (2 * sqrt(x))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %s", tt.input, err)
+			}
+			derivative, err := Derive(node, "x")
+			if err != nil {
+				t.Fatalf("Derive(%q) returned error: %s", tt.input, err)
+			}
+			if got := Format(derivative); got != tt.want {
+				t.Errorf("Derive(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDeriveErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		msg   string
+	}{
+		{"[x, 1]", "arrays can't be differentiated"},
+		{"x < 1", "operator < is not differentiable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %s", tt.input, err)
+			}
+			_, err = Derive(node, "x")
+			var deriveErr *Error
+			if !errors.As(err, &deriveErr) || deriveErr.Msg != tt.msg {
+				t.Errorf("Derive(%q) returned error %v, want %s", tt.input, err, tt.msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,20 @@
+package expr
+
+import "fmt"
+
+// Error is an error located in the source expression.
+// Pos and End are 1-based columns, so the offending text is [Pos, End).
+type Error struct {
+	Pos int
+	End int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Pos, e.Msg)
+}
+
+// Errorf returns an Error pointing at the given node.
+func Errorf(n Node, format string, args ...any) *Error {
+	return &Error{Pos: n.Pos(), End: n.End(), Msg: fmt.Sprintf(format, args...)}
+}
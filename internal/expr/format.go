@@ -0,0 +1,94 @@
+package expr
+
+import (
+	"strings"
+)
+
+// Format returns the source text of the tree with as few parentheses as possible.
+// Formatting and parsing again results in an equivalent tree.
+func Format(node Node) string {
+	var b strings.Builder
+	format(&b, node, 0)
+	return b.String()
+}
+
+// Precedence of nodes which are not binary operators, see precedence.
+const (
+	unaryPrec = 6
+	powPrec   = 7
+	// operandPrec is the precedence of literals, names and calls, which never need parentheses.
+	operandPrec = 8
+)
+
+// nodePrec returns how tightly the node binds its operands.
+func nodePrec(node Node) int {
+	switch n := node.(type) {
+	case *BinaryExpr:
+		if n.Op == Pow {
+			return powPrec
+		}
+		return precedence[n.Op]
+	case *UnaryExpr:
+		return unaryPrec
+	case *ParenExpr:
+		return nodePrec(n.X)
+	}
+	return operandPrec
+}
+
+// format writes the node, enclosing it in parentheses if it binds looser than minPrec.
+func format(b *strings.Builder, node Node, minPrec int) {
+	if paren, ok := node.(*ParenExpr); ok {
+		format(b, paren.X, minPrec)
+		return
+	}
+
+	if nodePrec(node) < minPrec {
+		b.WriteString("(")
+		defer b.WriteString(")")
+	}
+
+	switch n := node.(type) {
+	case *NumberLit:
+		b.WriteString(n.Raw)
+	case *Ident:
+		b.WriteString(n.Name)
+	case *ListExpr:
+		b.WriteString("[")
+		for i, elem := range n.Elems {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			format(b, elem, 0)
+		}
+		b.WriteString("]")
+	case *CallExpr:
+		b.WriteString(n.Fun.Name)
+		b.WriteString("(")
+		for i, arg := range n.Args {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			format(b, arg, 0)
+		}
+		b.WriteString(")")
+	case *UnaryExpr:
+		b.WriteString(n.Op.String())
+		// The operand of a sign may have its own sign, e.g. --x
+		format(b, n.X, unaryPrec)
+	case *BinaryExpr:
+		if n.Op == Pow {
+			// Pow is right-associative and binds tighter than signs of the base, so (-2)^x needs parentheses
+			format(b, n.X, operandPrec)
+			b.WriteString("^")
+			format(b, n.Y, unaryPrec)
+			return
+		}
+
+		prec := precedence[n.Op]
+		format(b, n.X, prec)
+		b.WriteString(" " + n.Op.String() + " ")
+		// Operators are left-associative, so a-(b-c) needs parentheses
+		format(b, n.Y, prec+1)
+	}
+}
@@ -0,0 +1,236 @@
+package expr
+
+import (
+	"strings"
+)
+
+// latexOperators are LaTeX forms of infix operators which are written inline.
+var latexOperators = map[Kind]string{
+	Add: "+",
+	Sub: "-",
+	Mul: `\cdot`,
+	Rem: `\bmod`,
+	Eql: "=",
+	Neq: `\neq`,
+	Lss: "<",
+	Leq: `\leq`,
+	Gtr: ">",
+	Geq: `\geq`,
+	And: `\land`,
+	Or:  `\lor`,
+	Dot: `\bullet`,
+}
+
+// latexFunctions are LaTeX commands of built-in functions written as `\sin\left(x\right)`.
+var latexFunctions = map[string]string{
+	"exp":  `\exp`,
+	"ln":   `\ln`,
+	"log":  `\log_{10}`,
+	"log2": `\log_{2}`,
+	"sin":  `\sin`,
+	"cos":  `\cos`,
+	"tan":  `\tan`,
+	"asin": `\arcsin`,
+	"acos": `\arccos`,
+	"atan": `\arctan`,
+	"min":  `\min`,
+	"max":  `\max`,
+	"gcd":  `\gcd`,
+	"arg":  `\arg`,
+}
+
+// latexConstants are LaTeX forms of constants written with Greek letters.
+var latexConstants = map[string]string{
+	"pi":  `\pi`,
+	"tau": `\tau`,
+	"phi": `\varphi`,
+}
+
+// LaTeX returns the tree as a LaTeX formula, e.g. `\frac{1}{2} \cdot \sqrt{x}`.
+func LaTeX(node Node) string {
+	var b strings.Builder
+	latex(&b, node, 0)
+	return b.String()
+}
+
+// displayPrec returns how tightly the node binds its operands when fractions are drawn,
+// see nodePrec. Fractions and floor divisions are delimited by their own layout.
+func displayPrec(node Node) int {
+	switch n := node.(type) {
+	case *ParenExpr:
+		return displayPrec(n.X)
+	case *BinaryExpr:
+		if n.Op == Quo || n.Op == FloorQuo {
+			return operandPrec
+		}
+	}
+	return nodePrec(node)
+}
+
+// basePrec returns the precedence the base of a power has to have to be written without parentheses.
+// Fractions are enclosed too, so that the exponent clearly applies to the whole fraction.
+func basePrec(base Node) int {
+	if displayPrec(base) == operandPrec && nodePrec(base) != operandPrec {
+		return operandPrec + 1
+	}
+	return operandPrec
+}
+
+func latex(b *strings.Builder, node Node, minPrec int) {
+	if paren, ok := node.(*ParenExpr); ok {
+		latex(b, paren.X, minPrec)
+		return
+	}
+
+	if displayPrec(node) < minPrec {
+		b.WriteString(`\left(`)
+		defer b.WriteString(`\right)`)
+	}
+
+	switch n := node.(type) {
+	case *NumberLit:
+		b.WriteString(latexNumber(n.Raw))
+	case *Ident:
+		if name, ok := latexConstants[n.Name]; ok {
+			b.WriteString(name)
+		} else if len(n.Name) == 1 {
+			b.WriteString(n.Name)
+		} else {
+			b.WriteString(`\mathrm{` + n.Name + `}`)
+		}
+	case *UnaryExpr:
+		if n.Op == Not {
+			b.WriteString(`\lnot `)
+		} else {
+			b.WriteString(n.Op.String())
+		}
+		latex(b, n.X, unaryPrec)
+	case *BinaryExpr:
+		switch n.Op {
+		case Quo:
+			b.WriteString(`\frac{`)
+			latex(b, n.X, 0)
+			b.WriteString(`}{`)
+			latex(b, n.Y, 0)
+			b.WriteString(`}`)
+			return
+		case FloorQuo:
+			b.WriteString(`\left\lfloor \frac{`)
+			latex(b, n.X, 0)
+			b.WriteString(`}{`)
+			latex(b, n.Y, 0)
+			b.WriteString(`} \right\rfloor`)
+			return
+		case Pow:
+			b.WriteString("{")
+			latex(b, n.X, basePrec(n.X))
+			b.WriteString("}^{")
+			latex(b, n.Y, 0)
+			b.WriteString("}")
+			return
+		}
+
+		prec := precedence[n.Op]
+		latex(b, n.X, prec)
+		b.WriteString(" " + latexOperators[n.Op] + " ")
+		latex(b, n.Y, prec+1)
+	case *ListExpr:
+		b.WriteString(`\begin{bmatrix} `)
+		for i, elem := range n.Elems {
+			row, ok := elem.(*ListExpr)
+			if !ok {
+				// A vector is written as a single row
+				if i > 0 {
+					b.WriteString(" & ")
+				}
+				latex(b, elem, 0)
+				continue
+			}
+			if i > 0 {
+				b.WriteString(` \\ `)
+			}
+			for j, item := range row.Elems {
+				if j > 0 {
+					b.WriteString(" & ")
+				}
+				latex(b, item, 0)
+			}
+		}
+		b.WriteString(` \end{bmatrix}`)
+	case *CallExpr:
+		latexCall(b, n)
+	}
+}
+
+func latexCall(b *strings.Builder, n *CallExpr) {
+	if len(n.Args) == 1 {
+		switch n.Fun.Name {
+		case "sqrt":
+			b.WriteString(`\sqrt{`)
+			latex(b, n.Args[0], 0)
+			b.WriteString(`}`)
+			return
+		case "abs":
+			latexDelimited(b, `\left|`, n.Args[0], `\right|`)
+			return
+		case "floor":
+			latexDelimited(b, `\left\lfloor`, n.Args[0], `\right\rfloor`)
+			return
+		case "ceil":
+			latexDelimited(b, `\left\lceil`, n.Args[0], `\right\rceil`)
+			return
+		case "conj":
+			b.WriteString(`\overline{`)
+			latex(b, n.Args[0], 0)
+			b.WriteString(`}`)
+			return
+		case "factorial":
+			latex(b, n.Args[0], operandPrec)
+			b.WriteString("!")
+			return
+		}
+	}
+	if n.Fun.Name == "if" && len(n.Args) == 3 {
+		b.WriteString(`\begin{cases} `)
+		latex(b, n.Args[1], 0)
+		b.WriteString(` & \text{if } `)
+		latex(b, n.Args[0], 0)
+		b.WriteString(` \\ `)
+		latex(b, n.Args[2], 0)
+		b.WriteString(` & \text{otherwise} \end{cases}`)
+		return
+	}
+
+	if name, ok := latexFunctions[n.Fun.Name]; ok {
+		b.WriteString(name)
+	} else {
+		b.WriteString(`\operatorname{` + n.Fun.Name + `}`)
+	}
+	b.WriteString(`\left(`)
+	for i, arg := range n.Args {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		latex(b, arg, 0)
+	}
+	b.WriteString(`\right)`)
+}
+
+func latexDelimited(b *strings.Builder, left string, node Node, right string) {
+	b.WriteString(left + " ")
+	latex(b, node, 0)
+	b.WriteString(" " + right)
+}
+
+// latexNumber writes exponents of numbers in scientific notation as powers of ten, e.g. 1e+21 is 1 \cdot 10^{21}.
+func latexNumber(raw string) string {
+	text, imag := strings.CutSuffix(raw, "i")
+	if i := strings.IndexAny(text, "eE"); i >= 0 {
+		exponent := strings.TrimPrefix(text[i+1:], "+")
+		text = text[:i] + ` \cdot 10^{` + exponent + `}`
+	}
+	if imag {
+		text += " i"
+	}
+	return text
+}
@@ -0,0 +1,142 @@
+package expr
+
+import (
+	"fmt"
+	"unicode"
+)
+
+var singleCharTokens = map[rune]Kind{
+	'(': LParen,
+	')': RParen,
+	',': Comma,
+	'+': Add,
+	'-': Sub,
+	'*': Mul,
+	'/': Quo,
+	'%': Rem,
+	'^': Pow,
+	'<': Lss,
+	'>': Gtr,
+	'!': Not,
+	'=': Assign,
+	'[': LBrack,
+	']': RBrack,
+	'.': Dot,
+}
+
+// doubleCharTokens are checked before singleCharTokens, so that "<=" isn't read as "<" and "=".
+var doubleCharTokens = map[string]Kind{
+	"//": FloorQuo,
+	"==": Eql,
+	"!=": Neq,
+	"<=": Leq,
+	">=": Geq,
+	"&&": And,
+	"||": Or,
+}
+
+// Tokenize splits the input into tokens. The last token is always EOF.
+func Tokenize(input string) ([]Token, error) {
+	src := []rune(input)
+	var tokens []Token
+
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		// A dot without digits after it is the dot product, e.g. [1, 2] . [3, 4]
+		case isDigit(c) || c == '.' && i+1 < len(src) && isDigit(src[i+1]):
+			end, err := scanNumber(src, i)
+			if err != nil {
+				return nil, err
+			}
+			kind := Number
+			if src[end-1] == 'i' {
+				kind = Imag
+			}
+			tokens = append(tokens, Token{Kind: kind, Text: string(src[i:end]), Pos: i + 1})
+			i = end
+		case isIdentStart(c):
+			end := i + 1
+			for end < len(src) && (isIdentStart(src[end]) || isDigit(src[end])) {
+				end++
+			}
+			tokens = append(tokens, Token{Kind: Name, Text: string(src[i:end]), Pos: i + 1})
+			i = end
+		case i+1 < len(src) && isDoubleCharToken(src[i:i+2]):
+			text := string(src[i : i+2])
+			tokens = append(tokens, Token{Kind: doubleCharTokens[text], Text: text, Pos: i + 1})
+			i += 2
+		default:
+			kind, ok := singleCharTokens[c]
+			if !ok {
+				return nil, &Error{Pos: i + 1, End: i + 2, Msg: fmt.Sprintf("unexpected character %q", c)}
+			}
+			tokens = append(tokens, Token{Kind: kind, Text: string(c), Pos: i + 1})
+			i++
+		}
+	}
+
+	tokens = append(tokens, Token{Kind: EOF, Pos: len(src) + 1})
+	return tokens, nil
+}
+
+// scanNumber returns the index right after the number literal starting at src[start].
+// Accepted forms are 12, 12.5, .5, 12. and any of them followed by an exponent (1e9, 2.5E-3).
+// The number may end with i, making it imaginary (4i, 1.5e3i).
+func scanNumber(src []rune, start int) (int, error) {
+	i := start
+	digits := 0
+	for i < len(src) && isDigit(src[i]) {
+		i++
+		digits++
+	}
+	if i < len(src) && src[i] == '.' {
+		i++
+		for i < len(src) && isDigit(src[i]) {
+			i++
+			digits++
+		}
+	}
+	if digits == 0 {
+		return 0, &Error{Pos: start + 1, End: i + 1, Msg: "malformed number: no digits"}
+	}
+
+	if i < len(src) && (src[i] == 'e' || src[i] == 'E') {
+		i++
+		if i < len(src) && (src[i] == '+' || src[i] == '-') {
+			i++
+		}
+		expDigits := 0
+		for i < len(src) && isDigit(src[i]) {
+			i++
+			expDigits++
+		}
+		if expDigits == 0 {
+			return 0, &Error{Pos: start + 1, End: i + 1, Msg: fmt.Sprintf("malformed number %q: exponent has no digits", string(src[start:i]))}
+		}
+	}
+
+	if i < len(src) && src[i] == 'i' && (i+1 == len(src) || !isIdentStart(src[i+1]) && !isDigit(src[i+1])) {
+		i++
+	}
+
+	if i < len(src) && (isDigit(src[i]) || src[i] == '.' || isIdentStart(src[i])) {
+		return 0, &Error{Pos: start + 1, End: i + 2, Msg: fmt.Sprintf("malformed number %q", string(src[start:i+1]))}
+	}
+	return i, nil
+}
+
+func isDoubleCharToken(s []rune) bool {
+	_, ok := doubleCharTokens[string(s)]
+	return ok
+}
+
+func isIdentStart(c rune) bool {
+	return c == '_' || unicode.IsLetter(c)
+}
+
+func isDigit(c rune) bool {
+	return c >= '0' && c <= '9'
+}
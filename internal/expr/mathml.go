@@ -0,0 +1,168 @@
+package expr
+
+import (
+	"html"
+	"strings"
+)
+
+// mathmlOperators are MathML forms of infix operators which are written inline.
+var mathmlOperators = map[Kind]string{
+	Add: "+",
+	Sub: "&#x2212;",
+	Mul: "&#x22C5;",
+	Rem: "mod",
+	Eql: "=",
+	Neq: "&#x2260;",
+	Lss: "&lt;",
+	Leq: "&#x2264;",
+	Gtr: "&gt;",
+	Geq: "&#x2265;",
+	And: "&#x2227;",
+	Or:  "&#x2228;",
+	Not: "&#x00AC;",
+	Dot: "&#x2219;",
+}
+
+// mathmlConstants are MathML forms of constants written with Greek letters.
+var mathmlConstants = map[string]string{
+	"pi":  "&#x03C0;",
+	"tau": "&#x03C4;",
+	"phi": "&#x03C6;",
+}
+
+// MathML returns the tree as a presentation MathML formula enclosed in a <math> element.
+func MathML(node Node) string {
+	var b strings.Builder
+	b.WriteString(`<math xmlns="http://www.w3.org/1998/Math/MathML">`)
+	mathml(&b, node, 0)
+	b.WriteString(`</math>`)
+	return b.String()
+}
+
+func mathml(b *strings.Builder, node Node, minPrec int) {
+	if paren, ok := node.(*ParenExpr); ok {
+		mathml(b, paren.X, minPrec)
+		return
+	}
+
+	b.WriteString("<mrow>")
+	defer b.WriteString("</mrow>")
+	if displayPrec(node) < minPrec {
+		b.WriteString("<mo>(</mo>")
+		defer b.WriteString("<mo>)</mo>")
+	}
+
+	switch n := node.(type) {
+	case *NumberLit:
+		if text, ok := strings.CutSuffix(n.Raw, "i"); ok {
+			b.WriteString("<mn>" + html.EscapeString(text) + "</mn><mi>i</mi>")
+		} else {
+			b.WriteString("<mn>" + html.EscapeString(n.Raw) + "</mn>")
+		}
+	case *Ident:
+		if name, ok := mathmlConstants[n.Name]; ok {
+			b.WriteString("<mi>" + name + "</mi>")
+		} else {
+			b.WriteString("<mi>" + html.EscapeString(n.Name) + "</mi>")
+		}
+	case *UnaryExpr:
+		b.WriteString("<mo>" + mathmlOperators[n.Op] + "</mo>")
+		mathml(b, n.X, unaryPrec)
+	case *BinaryExpr:
+		switch n.Op {
+		case Quo, FloorQuo:
+			if n.Op == FloorQuo {
+				b.WriteString("<mo>&#x230A;</mo>")
+				defer b.WriteString("<mo>&#x230B;</mo>")
+			}
+			b.WriteString("<mfrac>")
+			mathml(b, n.X, 0)
+			mathml(b, n.Y, 0)
+			b.WriteString("</mfrac>")
+			return
+		case Pow:
+			b.WriteString("<msup>")
+			mathml(b, n.X, basePrec(n.X))
+			mathml(b, n.Y, 0)
+			b.WriteString("</msup>")
+			return
+		}
+
+		prec := precedence[n.Op]
+		mathml(b, n.X, prec)
+		b.WriteString("<mo>" + mathmlOperators[n.Op] + "</mo>")
+		mathml(b, n.Y, prec+1)
+	case *ListExpr:
+		b.WriteString("<mo>[</mo><mtable>")
+		if _, ok := n.Elems[0].(*ListExpr); !ok {
+			// A vector is written as a single row
+			n = &ListExpr{Elems: []Node{n}}
+		}
+		for _, elem := range n.Elems {
+			b.WriteString("<mtr>")
+			row, ok := elem.(*ListExpr)
+			if !ok {
+				row = &ListExpr{Elems: []Node{elem}}
+			}
+			for _, item := range row.Elems {
+				b.WriteString("<mtd>")
+				mathml(b, item, 0)
+				b.WriteString("</mtd>")
+			}
+			b.WriteString("</mtr>")
+		}
+		b.WriteString("</mtable><mo>]</mo>")
+	case *CallExpr:
+		mathmlCall(b, n)
+	}
+}
+
+func mathmlCall(b *strings.Builder, n *CallExpr) {
+	if len(n.Args) == 1 {
+		switch n.Fun.Name {
+		case "sqrt":
+			b.WriteString("<msqrt>")
+			mathml(b, n.Args[0], 0)
+			b.WriteString("</msqrt>")
+			return
+		case "abs":
+			mathmlDelimited(b, "|", n.Args[0], "|")
+			return
+		case "floor":
+			mathmlDelimited(b, "&#x230A;", n.Args[0], "&#x230B;")
+			return
+		case "ceil":
+			mathmlDelimited(b, "&#x2308;", n.Args[0], "&#x2309;")
+			return
+		case "factorial":
+			mathml(b, n.Args[0], operandPrec)
+			b.WriteString("<mo>!</mo>")
+			return
+		}
+	}
+	if n.Fun.Name == "if" && len(n.Args) == 3 {
+		b.WriteString("<mo>{</mo><mtable><mtr><mtd>")
+		mathml(b, n.Args[1], 0)
+		b.WriteString("</mtd><mtd><mtext>if&#xA0;</mtext>")
+		mathml(b, n.Args[0], 0)
+		b.WriteString("</mtd></mtr><mtr><mtd>")
+		mathml(b, n.Args[2], 0)
+		b.WriteString("</mtd><mtd><mtext>otherwise</mtext></mtd></mtr></mtable>")
+		return
+	}
+
+	b.WriteString("<mi>" + html.EscapeString(n.Fun.Name) + "</mi><mo>&#x2061;</mo><mrow><mo>(</mo>")
+	for i, arg := range n.Args {
+		if i > 0 {
+			b.WriteString("<mo>,</mo>")
+		}
+		mathml(b, arg, 0)
+	}
+	b.WriteString("<mo>)</mo></mrow>")
+}
+
+func mathmlDelimited(b *strings.Builder, left string, node Node, right string) {
+	b.WriteString("<mo>" + left + "</mo>")
+	mathml(b, node, 0)
+	b.WriteString("<mo>" + right + "</mo>")
+}
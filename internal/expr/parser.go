@@ -0,0 +1,247 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// precedence of left-associative binary operators. Higher binds tighter.
+// Pow is handled separately in parsePower: it is right-associative and binds tighter than unary signs.
+var precedence = map[Kind]int{
+	Or:       1,
+	And:      2,
+	Eql:      3,
+	Neq:      3,
+	Lss:      3,
+	Leq:      3,
+	Gtr:      3,
+	Geq:      3,
+	Add:      4,
+	Sub:      4,
+	Mul:      5,
+	Quo:      5,
+	FloorQuo: 5,
+	Rem:      5,
+	Dot:      5,
+}
+
+// maxNesting limits nesting of parentheses, brackets, calls, unary operators and powers.
+// The parser and everything that walks the tree are recursive, so deeper expressions would overflow the stack.
+const maxNesting = 1000
+
+type parser struct {
+	tokens []Token
+	pos    int
+	// depth is the number of nested parseUnary calls
+	depth int
+}
+
+// Parse parses a mathematical expression.
+// Returned errors are of type *Error and point at the offending token.
+func Parse(input string) (Node, error) {
+	tokens, err := Tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	if p.peek().Kind == EOF {
+		return nil, p.errorf(p.peek(), "expression is empty")
+	}
+
+	node, err := p.parseBinary(1)
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.Kind != EOF {
+		return nil, p.errorf(tok, "unexpected %s", describe(tok))
+	}
+	return node, nil
+}
+
+func (p *parser) peek() Token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() Token {
+	tok := p.tokens[p.pos]
+	if tok.Kind != EOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) errorf(tok Token, format string, args ...any) *Error {
+	end := tok.End()
+	if end == tok.Pos {
+		end++
+	}
+	return &Error{Pos: tok.Pos, End: end, Msg: fmt.Sprintf(format, args...)}
+}
+
+// parseBinary parses a chain of binary operators with precedence not lower than minPrec.
+func (p *parser) parseBinary(minPrec int) (Node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		tok := p.peek()
+		prec, ok := precedence[tok.Kind]
+		if !ok || prec < minPrec {
+			return left, nil
+		}
+		p.next()
+
+		right, err := p.parseBinary(prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		left = &BinaryExpr{X: left, Op: tok.Kind, OpPos: tok.Pos, Y: right}
+	}
+}
+
+// parseUnary parses an operand preceded by any number of unary +, - and ! operators.
+// Every nested subexpression is parsed through it, so it also counts the nesting depth.
+func (p *parser) parseUnary() (Node, error) {
+	tok := p.peek()
+	p.depth++
+	defer func() { p.depth-- }()
+	if p.depth > maxNesting {
+		return nil, p.errorf(tok, "expression is nested too deeply")
+	}
+	if tok.Kind != Add && tok.Kind != Sub && tok.Kind != Not {
+		return p.parsePower()
+	}
+	p.next()
+
+	x, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &UnaryExpr{Op: tok.Kind, OpPos: tok.Pos, X: x}, nil
+}
+
+// parsePower parses an operand optionally raised to a power.
+// The exponent may have its own sign and power, so `2^-1` and `2^3^2` = `2^(3^2)` are accepted.
+func (p *parser) parsePower() (Node, error) {
+	base, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+
+	tok := p.peek()
+	if tok.Kind != Pow {
+		return base, nil
+	}
+	p.next()
+
+	exponent, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	return &BinaryExpr{X: base, Op: Pow, OpPos: tok.Pos, Y: exponent}, nil
+}
+
+func (p *parser) parseOperand() (Node, error) {
+	tok := p.next()
+	switch tok.Kind {
+	case Number, Imag:
+		// Numbers out of float64 range are kept as ±Inf, they may be valid in exact modes
+		text := strings.TrimSuffix(tok.Text, "i")
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil && !errors.Is(err, strconv.ErrRange) {
+			return nil, p.errorf(tok, "malformed number %q", tok.Text)
+		}
+		return &NumberLit{ValuePos: tok.Pos, Raw: tok.Text, Value: value, Imag: tok.Kind == Imag}, nil
+	case Name:
+		ident := &Ident{NamePos: tok.Pos, Name: tok.Text}
+		if p.peek().Kind != LParen {
+			return ident, nil
+		}
+		return p.parseCall(ident)
+	case LParen:
+		x, err := p.parseBinary(1)
+		if err != nil {
+			return nil, err
+		}
+		rparen := p.next()
+		if rparen.Kind != RParen {
+			return nil, p.errorf(rparen, "expected ) to close ( at column %d, found %s", tok.Pos, describe(rparen))
+		}
+		return &ParenExpr{Lparen: tok.Pos, X: x, Rparen: rparen.Pos}, nil
+	case LBrack:
+		return p.parseList(tok)
+	}
+	return nil, p.errorf(tok, "expected number, name, ( or [, found %s", describe(tok))
+}
+
+// parseCall parses the argument list of a function call. The current token is the opening parenthesis.
+func (p *parser) parseCall(fun *Ident) (Node, error) {
+	lparen := p.next()
+	call := &CallExpr{Fun: fun, Lparen: lparen.Pos}
+
+	if p.peek().Kind == RParen {
+		call.Rparen = p.next().Pos
+		return call, nil
+	}
+
+	for {
+		arg, err := p.parseBinary(1)
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+
+		tok := p.next()
+		switch tok.Kind {
+		case Comma:
+			continue
+		case RParen:
+			call.Rparen = tok.Pos
+			return call, nil
+		}
+		return nil, p.errorf(tok, "expected , or ) in arguments of %s, found %s", fun.Name, describe(tok))
+	}
+}
+
+// parseList parses the elements of an array literal. lbrack is the opening bracket.
+func (p *parser) parseList(lbrack Token) (Node, error) {
+	list := &ListExpr{Lbrack: lbrack.Pos}
+	if p.peek().Kind == RBrack {
+		return nil, p.errorf(p.peek(), "arrays can't be empty")
+	}
+
+	for {
+		elem, err := p.parseBinary(1)
+		if err != nil {
+			return nil, err
+		}
+		list.Elems = append(list.Elems, elem)
+
+		tok := p.next()
+		switch tok.Kind {
+		case Comma:
+			continue
+		case RBrack:
+			list.Rbrack = tok.Pos
+			return list, nil
+		}
+		return nil, p.errorf(tok, "expected , or ] to close [ at column %d, found %s", lbrack.Pos, describe(tok))
+	}
+}
+
+func describe(tok Token) string {
+	switch tok.Kind {
+	case EOF:
+		return "end of expression"
+	case Number, Imag:
+		return fmt.Sprintf("number %s", tok.Text)
+	case Name:
+		return fmt.Sprintf("name %s", tok.Text)
+	}
+	return fmt.Sprintf("%q", tok.Text)
+}
@@ -0,0 +1,183 @@
+package expr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// group writes the tree with every operation in parentheses, so that precedence and associativity are visible.
+func group(node Node) string {
+	switch n := node.(type) {
+	case *NumberLit:
+		return n.Raw
+	case *Ident:
+		return n.Name
+	case *ParenExpr:
+		return group(n.X)
+	case *UnaryExpr:
+		return fmt.Sprintf("(%s%s)", n.Op, group(n.X))
+	case *BinaryExpr:
+		return fmt.Sprintf("(%s %s %s)", group(n.X), n.Op, group(n.Y))
+	case *CallExpr:
+		args := make([]string, len(n.Args))
+		for i, arg := range n.Args {
+			args[i] = group(arg)
+		}
+		return fmt.Sprintf("%s(%s)", n.Fun.Name, strings.Join(args, ", "))
+	case *ListExpr:
+		elems := make([]string, len(n.Elems))
+		for i, elem := range n.Elems {
+			elems[i] = group(elem)
+		}
+		return fmt.Sprintf("[%s]", strings.Join(elems, ", "))
+	}
+	return fmt.Sprintf("%T", node)
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"1", "1"},
+		{"1 + 2 * 3", "(1 + (2 * 3))"},
+		{"(1 + 2) * 3", "((1 + 2) * 3)"},
+		{"1 - 2 - 3", "((1 - 2) - 3)"},
+		{"8 / 4 / 2", "((8 / 4) / 2)"},
+		{"7 // 2 % 3", "((7 // 2) % 3)"},
+		{"2 ^ 3 ^ 2", "(2 ^ (3 ^ 2))"},
+		{"-2 ^ 2", "(-(2 ^ 2))"},
+		{"2 ^ -1", "(2 ^ (-1))"},
+		{"2 * -3", "(2 * (-3))"},
+		{"--1", "(-(-1))"},
+		{"+1", "(+1)"},
+		{"1 + 2 < 3 * 4", "((1 + 2) < (3 * 4))"},
+		{"a < b && c != d || !e", "(((a < b) && (c != d)) || (!e))"},
+		{"a || b && c", "(a || (b && c))"},
+		{"1 == 2 == 3", "((1 == 2) == 3)"},
+		{"max(1, 2 + 3) * 2", "(max(1, (2 + 3)) * 2)"},
+		{"f()", "f()"},
+		{"[1, 2] . [3, 4] + 1", "(([1, 2] . [3, 4]) + 1)"},
+		{"[[1, 2], [3, 4]]", "[[1, 2], [3, 4]]"},
+		{"1.5e3 + .5 + 2.", "((1.5e3 + .5) + 2.)"},
+		{"3 + 4i", "(3 + 4i)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %s", tt.input, err)
+			}
+			if got := group(node); got != tt.want {
+				t.Errorf("Parse(%q) = %s, want %s", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		pos   int
+		msg   string
+	}{
+		{"", 1, "expression is empty"},
+		{"1 +", 4, "expected number, name, ( or [, found end of expression"},
+		{"2 $ 3", 3, "unexpected character '$'"},
+		{"1e", 1, `malformed number "1e": exponent has no digits`},
+		{"12abc", 1, `malformed number "12a"`},
+		{"(1 + 2", 7, "expected ) to close ( at column 1, found end of expression"},
+		{"max(1 2)", 7, "expected , or ) in arguments of max, found number 2"},
+		{"[]", 2, "arrays can't be empty"},
+		{"1 2", 3, "unexpected number 2"},
+		{"'a'", 1, "unexpected character '\\''"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			var parseErr *Error
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Parse(%q) returned %v, want *Error", tt.input, err)
+			}
+			if parseErr.Pos != tt.pos || parseErr.Msg != tt.msg {
+				t.Errorf("Parse(%q) error = column %d: %s, want column %d: %s", tt.input, parseErr.Pos, parseErr.Msg, tt.pos, tt.msg)
+			}
+		})
+	}
+}
+
+func TestParseNesting(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		err   bool
+	}{
+		{"parentheses at limit", strings.Repeat("(", maxNesting-1) + "1" + strings.Repeat(")", maxNesting-1), false},
+		{"parentheses", strings.Repeat("(", maxNesting) + "1" + strings.Repeat(")", maxNesting), true},
+		{"unary minus", strings.Repeat("-", maxNesting) + "1", true},
+		{"powers", strings.Repeat("2^", maxNesting) + "2", true},
+		{"calls", strings.Repeat("abs(", maxNesting) + "1" + strings.Repeat(")", maxNesting), true},
+		{"arrays", strings.Repeat("[", maxNesting) + "1" + strings.Repeat("]", maxNesting), true},
+		{"long chain", strings.Repeat("1+", 10*maxNesting) + "1", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.input)
+			if !tt.err {
+				if err != nil {
+					t.Errorf("Parse() returned error: %s", err)
+				}
+				return
+			}
+
+			var parseErr *Error
+			if !errors.As(err, &parseErr) {
+				t.Fatalf("Parse() returned %v, want *Error", err)
+			}
+			if parseErr.Msg != "expression is nested too deeply" {
+				t.Errorf("Parse() error = %s, want expression is nested too deeply", parseErr.Msg)
+			}
+		})
+	}
+}
+
+func TestFormatRoundTrip(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"((1 + 2)) * 3", "(1 + 2) * 3"},
+		{"1 - (2 - 3)", "1 - (2 - 3)"},
+		{"(1 - 2) - 3", "1 - 2 - 3"},
+		{"(2 ^ 3) ^ 2", "(2^3)^2"},
+		{"2 ^ (3 ^ 2)", "2^3^2"},
+		{"(-2) ^ 2", "(-2)^2"},
+		{"-(2 ^ 2)", "-2^2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			node, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %s", tt.input, err)
+			}
+			got := Format(node)
+			if got != tt.want {
+				t.Errorf("Format(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+
+			reparsed, err := Parse(got)
+			if err != nil {
+				t.Fatalf("Parse(%q) returned error: %s", got, err)
+			}
+			if group(reparsed) != group(node) {
+				t.Errorf("Format(%q) = %q parses as %s, want %s", tt.input, got, group(reparsed), group(node))
+			}
+		})
+	}
+}
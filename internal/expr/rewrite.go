@@ -0,0 +1,56 @@
+package expr
+
+// Rewrite returns a copy of the tree where every node is replaced with the result of f.
+// Children are rewritten before their parents, and f receives the node with rewritten children.
+// Replacements returned by f are not rewritten again.
+func Rewrite(node Node, f func(Node) (Node, error)) (Node, error) {
+	var err error
+	switch n := node.(type) {
+	case *CallExpr:
+		call := *n
+		call.Args = make([]Node, len(n.Args))
+		for i, arg := range n.Args {
+			call.Args[i], err = Rewrite(arg, f)
+			if err != nil {
+				return nil, err
+			}
+		}
+		node = &call
+	case *BinaryExpr:
+		binary := *n
+		binary.X, err = Rewrite(n.X, f)
+		if err != nil {
+			return nil, err
+		}
+		binary.Y, err = Rewrite(n.Y, f)
+		if err != nil {
+			return nil, err
+		}
+		node = &binary
+	case *UnaryExpr:
+		unary := *n
+		unary.X, err = Rewrite(n.X, f)
+		if err != nil {
+			return nil, err
+		}
+		node = &unary
+	case *ParenExpr:
+		paren := *n
+		paren.X, err = Rewrite(n.X, f)
+		if err != nil {
+			return nil, err
+		}
+		node = &paren
+	case *ListExpr:
+		list := *n
+		list.Elems = make([]Node, len(n.Elems))
+		for i, elem := range n.Elems {
+			list.Elems[i], err = Rewrite(elem, f)
+			if err != nil {
+				return nil, err
+			}
+		}
+		node = &list
+	}
+	return f(node)
+}
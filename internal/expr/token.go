@@ -0,0 +1,95 @@
+package expr
+
+// Kind is a type of lexical token.
+type Kind uint8
+
+const (
+	EOF Kind = iota
+	Number
+	// Imag is an imaginary number literal, e.g. 4i.
+	Imag
+	Name
+	LParen
+	RParen
+	Comma
+
+	// Operators
+	Add
+	Sub
+	Mul
+	Quo
+	FloorQuo
+	Rem
+	Pow
+
+	// Comparison and logical operators
+	Eql
+	Neq
+	Lss
+	Leq
+	Gtr
+	Geq
+	And
+	Or
+	Not
+
+	// Assign separates the head and the body of a function definition.
+	Assign
+
+	// Arrays
+	LBrack
+	RBrack
+	// Dot is the dot product of vectors and matrices.
+	Dot
+)
+
+var kindNames = map[Kind]string{
+	EOF:      "end of expression",
+	Number:   "number",
+	Imag:     "imaginary number",
+	Name:     "name",
+	LParen:   "(",
+	RParen:   ")",
+	Comma:    ",",
+	Add:      "+",
+	Sub:      "-",
+	Mul:      "*",
+	Quo:      "/",
+	FloorQuo: "//",
+	Rem:      "%",
+	Pow:      "^",
+	Eql:      "==",
+	Neq:      "!=",
+	Lss:      "<",
+	Leq:      "<=",
+	Gtr:      ">",
+	Geq:      ">=",
+	And:      "&&",
+	Or:       "||",
+	Not:      "!",
+	Assign:   "=",
+	LBrack:   "[",
+	RBrack:   "]",
+	Dot:      ".",
+}
+
+func (k Kind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return "unknown token"
+}
+
+// Token is a lexical token of an expression.
+type Token struct {
+	Kind Kind
+	// Text is the source text of the token. It is empty for EOF.
+	Text string
+	// Pos is the 1-based column of the first character of the token.
+	Pos int
+}
+
+// End returns the column right after the last character of the token.
+func (t Token) End() int {
+	return t.Pos + len([]rune(t.Text))
+}
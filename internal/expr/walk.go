@@ -0,0 +1,27 @@
+package expr
+
+// Inspect traverses the tree in depth-first order, calling f for each node.
+// Children of a node are skipped if f returns false for it. Function names of calls are not visited.
+func Inspect(node Node, f func(Node) bool) {
+	if !f(node) {
+		return
+	}
+
+	switch n := node.(type) {
+	case *CallExpr:
+		for _, arg := range n.Args {
+			Inspect(arg, f)
+		}
+	case *BinaryExpr:
+		Inspect(n.X, f)
+		Inspect(n.Y, f)
+	case *UnaryExpr:
+		Inspect(n.X, f)
+	case *ParenExpr:
+		Inspect(n.X, f)
+	case *ListExpr:
+		for _, elem := range n.Elems {
+			Inspect(elem, f)
+		}
+	}
+}
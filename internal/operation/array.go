@@ -0,0 +1,202 @@
+package operation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// MaxArrayRank limits the number of dimensions of arrays: vectors have 1 and matrices have 2.
+const MaxArrayRank = 2
+
+// Array is a vector or a matrix of numbers of the same mode.
+// Array operands are stored in Exact as nested JSON arrays of strings, e.g. `[["1","2"],["3","4"]]`, in every mode.
+// Elements hold their Exact form, or the shortest decimal form of Value in ModeFloat.
+type Array struct {
+	// Shape is the length of every dimension, e.g. [2, 3] for a matrix of 2 rows and 3 columns.
+	Shape []int
+	// Elems are the elements in row-major order.
+	Elems []Operand
+}
+
+// IsArray reports whether the literal operand holds an array.
+func (o Operand) IsArray() bool {
+	return strings.HasPrefix(o.Exact, "[")
+}
+
+// Len returns the number of elements of an array of the shape.
+func (a Array) Len() int {
+	n := 1
+	for _, dim := range a.Shape {
+		n *= dim
+	}
+	return n
+}
+
+// ShapeString returns the shape as text for error messages, e.g. "2x3".
+func (a Array) ShapeString() string {
+	dims := make([]string, len(a.Shape))
+	for i, dim := range a.Shape {
+		dims[i] = strconv.Itoa(dim)
+	}
+	return strings.Join(dims, "x")
+}
+
+// Pack returns an array of the operands. They have to be either all numbers, resulting in a vector,
+// or all vectors of the same length, resulting in a matrix.
+func Pack(mode Mode, elems []Operand) (Operand, error) {
+	if len(elems) == 0 {
+		return Operand{}, fmt.Errorf("arrays can't be empty")
+	}
+
+	var shape []int
+	var result []Operand
+	for i, elem := range elems {
+		if !elem.IsArray() {
+			if shape != nil {
+				return Operand{}, fmt.Errorf("element %d of the array is a number, but previous ones are vectors", i+1)
+			}
+			result = append(result, elem)
+			continue
+		}
+
+		inner, err := elem.Array(mode)
+		if err != nil {
+			return Operand{}, err
+		}
+		switch {
+		case i > 0 && shape == nil:
+			return Operand{}, fmt.Errorf("element %d of the array is a vector, but previous ones are numbers", i+1)
+		case len(inner.Shape)+1 > MaxArrayRank:
+			return Operand{}, fmt.Errorf("arrays can have at most %d dimensions", MaxArrayRank)
+		case shape != nil && inner.Shape[0] != shape[0]:
+			return Operand{}, fmt.Errorf("dimension mismatch: row %d has %d element(s), but row 1 has %d", i+1, inner.Shape[0], shape[0])
+		}
+		shape = inner.Shape
+		result = append(result, inner.Elems...)
+	}
+
+	return ArrayOperand(mode, Array{Shape: append([]int{len(elems)}, shape...), Elems: result})
+}
+
+// ArrayOperand returns a literal operand holding the array.
+func ArrayOperand(mode Mode, a Array) (Operand, error) {
+	if len(a.Elems) != a.Len() {
+		return Operand{}, fmt.Errorf("array of shape %s can't have %d elements", a.ShapeString(), len(a.Elems))
+	}
+
+	var b bytes.Buffer
+	var encode func(shape []int, elems []Operand)
+	encode = func(shape []int, elems []Operand) {
+		b.WriteString("[")
+		step := len(elems) / shape[0]
+		for i := 0; i < shape[0]; i++ {
+			if i > 0 {
+				b.WriteString(",")
+			}
+			if len(shape) > 1 {
+				encode(shape[1:], elems[i*step:(i+1)*step])
+				continue
+			}
+			b.WriteString(encodeElement(mode, elems[i]))
+		}
+		b.WriteString("]")
+	}
+	encode(a.Shape, a.Elems)
+
+	return Operand{Exact: b.String()}, nil
+}
+
+func encodeElement(mode Mode, x Operand) string {
+	text := x.Exact
+	if mode == ModeFloat || text == "" {
+		text = strconv.FormatFloat(x.Value, 'g', -1, 64)
+	}
+	data, _ := json.Marshal(text)
+	return string(data)
+}
+
+// Array returns the operand as an array.
+func (o Operand) Array(mode Mode) (Array, error) {
+	decoder := json.NewDecoder(strings.NewReader(o.Exact))
+	decoder.UseNumber()
+	var value any
+	if err := decoder.Decode(&value); err != nil {
+		return Array{}, fmt.Errorf("malformed array %q", o.Exact)
+	}
+
+	var a Array
+	var decode func(value any, depth int) error
+	decode = func(value any, depth int) error {
+		list, ok := value.([]any)
+		if !ok {
+			if depth != len(a.Shape) {
+				return fmt.Errorf("malformed array %q", o.Exact)
+			}
+			elem, err := decodeElement(mode, value)
+			if err != nil {
+				return err
+			}
+			a.Elems = append(a.Elems, elem)
+			return nil
+		}
+
+		switch {
+		case depth == len(a.Shape) && len(a.Elems) == 0:
+			a.Shape = append(a.Shape, len(list))
+		case depth >= len(a.Shape) || a.Shape[depth] != len(list):
+			return fmt.Errorf("malformed array %q", o.Exact)
+		}
+		for _, item := range list {
+			if err := decode(item, depth+1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := decode(value, 0); err != nil {
+		return Array{}, err
+	}
+	if len(a.Shape) == 0 || a.Len() == 0 || len(a.Elems) != a.Len() {
+		return Array{}, fmt.Errorf("malformed array %q", o.Exact)
+	}
+	return a, nil
+}
+
+func decodeElement(mode Mode, value any) (Operand, error) {
+	var text string
+	switch v := value.(type) {
+	case json.Number:
+		// Older arrays in ModeFloat have numbers as elements
+		text = v.String()
+	case string:
+		text = v
+	default:
+		return Operand{}, fmt.Errorf("malformed array element %v", value)
+	}
+
+	if mode == ModeFloat {
+		v, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return Operand{}, fmt.Errorf("malformed array element %q", text)
+		}
+		return Operand{Value: v}, nil
+	}
+
+	// Value is an approximation, calculations use Exact
+	x := Operand{Exact: text}
+	if mode == ModeComplex {
+		c, err := x.Complex()
+		x.Value = real(c)
+		return x, err
+	}
+	r, ok := new(big.Rat).SetString(text)
+	if !ok {
+		return Operand{}, fmt.Errorf("malformed array element %q", text)
+	}
+	x.Value, _ = r.Float64()
+	return x, nil
+}
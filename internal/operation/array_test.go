@@ -0,0 +1,57 @@
+package operation
+
+import (
+	"testing"
+)
+
+func TestArrayEncoding(t *testing.T) {
+	tests := []struct {
+		name  string
+		mode  Mode
+		elems []Operand
+		want  string
+	}{
+		{"float", ModeFloat, []Operand{{Value: 3}, {Value: 0.5}}, `["3","0.5"]`},
+		{"decimal", ModeDecimal, []Operand{{Value: 3, Exact: "3"}, {Value: 0.5, Exact: "0.5"}}, `["3","0.5"]`},
+		{"rational", ModeRational, []Operand{{Exact: "1/3"}, {Exact: "1/2"}}, `["1/3","1/2"]`},
+		{"complex", ModeComplex, []Operand{{Exact: "1+2i"}, {Exact: "0+0i"}}, `["1+2i","0+0i"]`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			x, err := ArrayOperand(tt.mode, Array{Shape: []int{len(tt.elems)}, Elems: tt.elems})
+			if err != nil {
+				t.Fatalf("ArrayOperand() returned error: %s", err)
+			}
+			if x.Exact != tt.want {
+				t.Errorf("ArrayOperand() = %s, want %s", x.Exact, tt.want)
+			}
+
+			a, err := x.Array(tt.mode)
+			if err != nil {
+				t.Fatalf("Array() returned error: %s", err)
+			}
+			again, err := ArrayOperand(tt.mode, a)
+			if err != nil || again.Exact != x.Exact {
+				t.Errorf("decoding and encoding %s results in %s, %v", x.Exact, again.Exact, err)
+			}
+		})
+	}
+}
+
+func TestArrayDecodeNumbers(t *testing.T) {
+	// Arrays in float mode used to be stored with numbers as elements
+	a, err := Operand{Exact: "[[1,2],[3,4.5]]"}.Array(ModeFloat)
+	if err != nil {
+		t.Fatalf("Array() returned error: %s", err)
+	}
+	if a.ShapeString() != "2x2" || a.Elems[3].Value != 4.5 {
+		t.Errorf("Array() = %+v, want a 2x2 matrix ending with 4.5", a)
+	}
+
+	for _, exact := range []string{"[]", "[[1,2],[3]]", "[1,[2]]", `["x"]`} {
+		if _, err := (Operand{Exact: exact}).Array(ModeFloat); err == nil {
+			t.Errorf("Array(%s) returned no error", exact)
+		}
+	}
+}
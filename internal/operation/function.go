@@ -0,0 +1,44 @@
+package operation
+
+// Function describes a built-in function that can be called from expressions.
+// A call is stored as an Operation with Op set to the function name and arguments as Operands.
+type Function struct {
+	Name Operator
+	// MinArgs and MaxArgs limit the number of arguments. MaxArgs is -1 for variadic functions.
+	MinArgs int
+	MaxArgs int
+}
+
+var functions = map[string]Function{}
+
+func registerFunction(name string, minArgs, maxArgs int) {
+	functions[name] = Function{Name: Operator(name), MinArgs: minArgs, MaxArgs: maxArgs}
+}
+
+func init() {
+	for _, name := range []string{
+		"sqrt", "abs", "exp", "ln", "log", "log2",
+		"sin", "cos", "tan", "asin", "acos", "atan",
+		"floor", "ceil", "round",
+		"re", "im", "conj", "arg",
+		"factorial",
+		"det", "transpose",
+	} {
+		registerFunction(name, 1, 1)
+	}
+	registerFunction("atan2", 2, 2)
+	for _, name := range []string{"min", "max", "sum", "avg", "gcd", "lcm"} {
+		registerFunction(name, 1, -1)
+	}
+}
+
+// LookupFunction returns the built-in function with the given name.
+func LookupFunction(name string) (Function, bool) {
+	fn, ok := functions[name]
+	return fn, ok
+}
+
+// AcceptsArgs reports whether the function can be called with n arguments.
+func (f Function) AcceptsArgs(n int) bool {
+	return n >= f.MinArgs && (f.MaxArgs == -1 || n <= f.MaxArgs)
+}
@@ -0,0 +1,126 @@
+package operation
+
+import (
+	"fmt"
+	"math"
+)
+
+// Bool returns 1 or 0 as a literal operand of the given mode.
+func Bool(mode Mode, b bool) Operand {
+	text := "0"
+	if b {
+		text = "1"
+	}
+	result, _ := Literal(mode, text)
+	return result
+}
+
+// Truth reports whether the literal operand is non-zero.
+func Truth(mode Mode, x Operand) (bool, error) {
+	if x.IsArray() {
+		return false, fmt.Errorf("an array can't be used as a condition")
+	}
+	switch mode {
+	case ModeRational, ModeInteger:
+		r, err := x.Rat()
+		if err != nil {
+			return false, err
+		}
+		return r.Sign() != 0, nil
+	case ModeDecimal:
+		d, err := x.Decimal()
+		if err != nil {
+			return false, err
+		}
+		return d.Sign() != 0, nil
+	case ModeComplex:
+		c, err := x.Complex()
+		if err != nil {
+			return false, err
+		}
+		return c != 0, nil
+	}
+
+	if math.IsNaN(x.Value) {
+		return false, fmt.Errorf("NaN can't be used as a condition")
+	}
+	return x.Value != 0, nil
+}
+
+// Compare returns -1, 0 or +1 depending on whether a is less than, equal to or greater than b.
+// Complex numbers with non-zero imaginary parts can only be compared for equality, see Equals.
+func Compare(mode Mode, a, b Operand) (int, error) {
+	if a.IsArray() || b.IsArray() {
+		return 0, fmt.Errorf("arrays can't be compared")
+	}
+	switch mode {
+	case ModeRational, ModeInteger:
+		x, err := a.Rat()
+		if err != nil {
+			return 0, err
+		}
+		y, err := b.Rat()
+		if err != nil {
+			return 0, err
+		}
+		return x.Cmp(y), nil
+	case ModeDecimal:
+		x, err := a.Decimal()
+		if err != nil {
+			return 0, err
+		}
+		y, err := b.Decimal()
+		if err != nil {
+			return 0, err
+		}
+		return x.Cmp(y), nil
+	case ModeComplex:
+		x, err := a.Complex()
+		if err != nil {
+			return 0, err
+		}
+		y, err := b.Complex()
+		if err != nil {
+			return 0, err
+		}
+		if imag(x) != 0 || imag(y) != 0 {
+			return 0, fmt.Errorf("complex numbers can't be ordered")
+		}
+		return compareFloats(real(x), real(y))
+	}
+	return compareFloats(a.Value, b.Value)
+}
+
+// Equals reports whether a and b are equal.
+func Equals(mode Mode, a, b Operand) (bool, error) {
+	if a.IsArray() || b.IsArray() {
+		return false, fmt.Errorf("arrays can't be compared")
+	}
+	if mode == ModeComplex {
+		x, err := a.Complex()
+		if err != nil {
+			return false, err
+		}
+		y, err := b.Complex()
+		if err != nil {
+			return false, err
+		}
+		return x == y, nil
+	}
+
+	c, err := Compare(mode, a, b)
+	return c == 0, err
+}
+
+func compareFloats(x, y float64) (int, error) {
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return 0, fmt.Errorf("NaN can't be compared")
+	}
+	switch {
+	case x < y:
+		return -1, nil
+	case x > y:
+		return 1, nil
+	}
+	return 0, nil
+}
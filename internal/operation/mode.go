@@ -0,0 +1,322 @@
+package operation
+
+import (
+	"errors"
+	"fmt"
+	"math-calc/internal/decimal"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Mode is the kind of numbers an operation is calculated with.
+type Mode string
+
+const (
+	// ModeFloat calculates with float64. Operand values are stored in Value, Exact is empty.
+	ModeFloat Mode = "float"
+	// ModeRational calculates with exact fractions. Operand values are stored in Exact as "num/den",
+	// Value holds the closest float64 approximation.
+	ModeRational Mode = "rational"
+	// ModeDecimal calculates with decimal numbers rounded to Operation.Precision significant digits.
+	// Operand values are stored in Exact in plain decimal notation, Value holds an approximation.
+	ModeDecimal Mode = "decimal"
+	// ModeComplex calculates with complex128. Operand values are stored in Exact as "re+imi",
+	// Value holds the real part.
+	ModeComplex Mode = "complex"
+	// ModeInteger calculates with arbitrary-precision integers. Operand values are stored in Exact
+	// as decimal digits, Value holds an approximation. Division rounds according to Operation.Rounding,
+	// or fails if the quotient is not an integer and no rounding is given.
+	ModeInteger Mode = "integer"
+)
+
+const (
+	// DefaultPrecision is the number of significant digits used in ModeDecimal if none is given.
+	DefaultPrecision = 34
+	// MaxPrecision limits the number of significant digits in ModeDecimal.
+	MaxPrecision = 1000
+	// maxLiteralExponent limits exponents of literals in exact modes, e.g. 1e10000.
+	maxLiteralExponent = 10000
+)
+
+// ParseMode returns the mode with the given name. Empty name stands for ModeFloat.
+func ParseMode(name string) (Mode, error) {
+	switch Mode(name) {
+	case "", ModeFloat:
+		return ModeFloat, nil
+	case ModeRational, ModeDecimal, ModeComplex, ModeInteger:
+		return Mode(name), nil
+	}
+	return "", fmt.Errorf("unknown mode %q", name)
+}
+
+// Literal converts a number in decimal notation into an operand of the given mode.
+// Imaginary literals like 4i are accepted only in ModeComplex.
+func Literal(mode Mode, text string) (Operand, error) {
+	if strings.HasSuffix(text, "i") && mode != ModeComplex {
+		return Operand{}, fmt.Errorf("imaginary number %s can be used only in complex mode", text)
+	}
+	if _, exponent, ok := strings.Cut(strings.ToLower(text), "e"); ok {
+		e, err := strconv.Atoi(strings.TrimSuffix(exponent, "i"))
+		if err != nil || e > maxLiteralExponent || e < -maxLiteralExponent {
+			return Operand{}, fmt.Errorf("exponent of number %s is out of range", text)
+		}
+	}
+
+	switch mode {
+	case ModeRational:
+		r, ok := new(big.Rat).SetString(text)
+		if !ok {
+			return Operand{}, fmt.Errorf("malformed number %q", text)
+		}
+		return RatOperand(r), nil
+	case ModeDecimal:
+		d, err := decimal.Parse(text)
+		if err != nil {
+			return Operand{}, err
+		}
+		return DecimalOperand(d), nil
+	case ModeInteger:
+		r, ok := new(big.Rat).SetString(text)
+		if !ok {
+			return Operand{}, fmt.Errorf("malformed number %q", text)
+		}
+		if !r.IsInt() {
+			return Operand{}, fmt.Errorf("number %s is not an integer", text)
+		}
+		return IntOperand(r.Num()), nil
+	case ModeComplex:
+		imag := strings.HasSuffix(text, "i")
+		value, err := strconv.ParseFloat(strings.TrimSuffix(text, "i"), 64)
+		if err != nil {
+			return Operand{}, fmt.Errorf("malformed number %q", text)
+		}
+		if imag {
+			return ComplexOperand(complex(0, value)), nil
+		}
+		return ComplexOperand(complex(value, 0)), nil
+	}
+
+	value, err := strconv.ParseFloat(text, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		return Operand{}, fmt.Errorf("number %s is out of range", text)
+	}
+	if err != nil {
+		return Operand{}, fmt.Errorf("malformed number %q", text)
+	}
+	return Operand{Value: value}, nil
+}
+
+// FromFloat converts a float64 into an operand of the given mode.
+// The shortest decimal representation of the value is used, so 0.1 becomes exactly 1/10.
+func FromFloat(mode Mode, value float64) (Operand, error) {
+	if mode == ModeFloat {
+		return Operand{Value: value}, nil
+	}
+	return Literal(mode, strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// Convert converts a literal operand calculated in mode from into the mode of o, e.g. when a result
+// of an expression in rational mode is used by an expression in decimal mode. Fractions are rounded
+// to o.Precision in ModeDecimal, values which can't be represented in the mode of o are rejected.
+func (o Operation) Convert(from Mode, x Operand) (Operand, error) {
+	to := o.Mode
+	if from == "" {
+		from = ModeFloat
+	}
+	if to == "" {
+		to = ModeFloat
+	}
+	if from == to {
+		return x, nil
+	}
+
+	if x.IsArray() {
+		a, err := x.Array(from)
+		if err != nil {
+			return Operand{}, err
+		}
+		for i, elem := range a.Elems {
+			a.Elems[i], err = o.Convert(from, elem)
+			if err != nil {
+				return Operand{}, err
+			}
+		}
+		return ArrayOperand(to, a)
+	}
+
+	switch from {
+	case ModeFloat:
+		return FromFloat(to, x.Value)
+	case ModeComplex:
+		c, err := x.Complex()
+		if err != nil {
+			return Operand{}, err
+		}
+		if imag(c) != 0 {
+			return Operand{}, fmt.Errorf("complex number %s can be used only in complex mode", x.Exact)
+		}
+		return FromFloat(to, real(c))
+	}
+
+	switch to {
+	case ModeFloat:
+		return Operand{Value: x.Value}, nil
+	case ModeComplex:
+		return ComplexOperand(complex(x.Value, 0)), nil
+	}
+
+	// Rationals, decimals and integers are all exact fractions
+	r, err := x.Rat()
+	if err != nil {
+		return Operand{}, err
+	}
+	switch to {
+	case ModeInteger:
+		if !r.IsInt() {
+			return Operand{}, fmt.Errorf("number %s is not an integer", r.RatString())
+		}
+		return IntOperand(r.Num()), nil
+	case ModeDecimal:
+		d := decimal.FromInt(r.Num())
+		if !r.IsInt() {
+			precision := o.Precision
+			if precision <= 0 {
+				precision = DefaultPrecision
+			}
+			d = d.Quo(decimal.FromInt(r.Denom()), precision, o.Rounding)
+		}
+		return DecimalOperand(d), nil
+	}
+	return RatOperand(r), nil
+}
+
+// Negate returns the negated literal operand.
+func Negate(mode Mode, x Operand) (Operand, error) {
+	switch mode {
+	case ModeRational:
+		r, err := x.Rat()
+		if err != nil {
+			return Operand{}, err
+		}
+		return RatOperand(r.Neg(r)), nil
+	case ModeDecimal:
+		d, err := x.Decimal()
+		if err != nil {
+			return Operand{}, err
+		}
+		return DecimalOperand(d.Neg()), nil
+	case ModeInteger:
+		n, err := x.Int()
+		if err != nil {
+			return Operand{}, err
+		}
+		return IntOperand(n.Neg(n)), nil
+	case ModeComplex:
+		c, err := x.Complex()
+		if err != nil {
+			return Operand{}, err
+		}
+		// Subtracting from zero keeps zero parts positive, so that sqrt(-1) is i rather than -i
+		return ComplexOperand(0 - c), nil
+	}
+	return Operand{Value: -x.Value}, nil
+}
+
+// RatOperand returns a literal operand holding the fraction.
+func RatOperand(r *big.Rat) Operand {
+	value, _ := r.Float64()
+	return Operand{Value: value, Exact: r.RatString()}
+}
+
+// Rat returns the operand as a fraction. Operands without Exact are converted from Value.
+func (o Operand) Rat() (*big.Rat, error) {
+	if o.Exact == "" {
+		return FromFloatRat(o.Value)
+	}
+	r, ok := new(big.Rat).SetString(o.Exact)
+	if !ok {
+		return nil, fmt.Errorf("malformed fraction %q", o.Exact)
+	}
+	return r, nil
+}
+
+// FromFloatRat converts a float64 into a fraction using its shortest decimal representation.
+func FromFloatRat(value float64) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(value, 'g', -1, 64))
+	if !ok {
+		return nil, fmt.Errorf("%g can't be represented as a fraction", value)
+	}
+	return r, nil
+}
+
+// DecimalOperand returns a literal operand holding the decimal.
+func DecimalOperand(d decimal.Decimal) Operand {
+	return Operand{Value: d.Float64(), Exact: d.String()}
+}
+
+// Decimal returns the operand as a decimal. Operands without Exact are converted from Value.
+// Fractions in Exact, e.g. coming from ModeRational, are not accepted.
+func (o Operand) Decimal() (decimal.Decimal, error) {
+	if o.Exact == "" {
+		return decimal.Parse(strconv.FormatFloat(o.Value, 'g', -1, 64))
+	}
+	return decimal.Parse(o.Exact)
+}
+
+// IntOperand returns a literal operand holding the integer.
+func IntOperand(n *big.Int) Operand {
+	value, _ := new(big.Float).SetInt(n).Float64()
+	return Operand{Value: value, Exact: n.String()}
+}
+
+// Int returns the operand as an integer. Operands without Exact are converted from Value.
+// Values with a fractional part are not accepted.
+func (o Operand) Int() (*big.Int, error) {
+	var r *big.Rat
+	if o.Exact == "" {
+		var err error
+		r, err = FromFloatRat(o.Value)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		var ok bool
+		r, ok = new(big.Rat).SetString(o.Exact)
+		if !ok {
+			return nil, fmt.Errorf("malformed integer %q", o.Exact)
+		}
+	}
+
+	if !r.IsInt() {
+		return nil, fmt.Errorf("number %s is not an integer", r.RatString())
+	}
+	return new(big.Int).Set(r.Num()), nil
+}
+
+// ComplexOperand returns a literal operand holding the complex number.
+func ComplexOperand(c complex128) Operand {
+	exact := strconv.FormatComplex(c, 'g', -1, 128)
+	return Operand{Value: real(c), Exact: exact[1 : len(exact)-1]}
+}
+
+// Complex returns the operand as a complex number. Operands without Exact are converted from Value.
+func (o Operand) Complex() (complex128, error) {
+	if o.Exact == "" {
+		return complex(o.Value, 0), nil
+	}
+	if strings.Contains(o.Exact, "/") {
+		r, err := o.Rat()
+		if err != nil {
+			return 0, err
+		}
+		value, _ := r.Float64()
+		return complex(value, 0), nil
+	}
+
+	c, err := strconv.ParseComplex(o.Exact, 128)
+	if err != nil {
+		return 0, fmt.Errorf("malformed complex number %q", o.Exact)
+	}
+	return c, nil
+}
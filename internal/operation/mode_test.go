@@ -0,0 +1,46 @@
+package operation
+
+import (
+	"math-calc/internal/decimal"
+	"testing"
+)
+
+func TestConvert(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    Mode
+		to      Operation
+		x       Operand
+		want    string
+		wantErr bool
+	}{
+		{"rational to decimal", ModeRational, Operation{Mode: ModeDecimal, Precision: 34}, Operand{Value: 0.3, Exact: "3/10"}, "0.3", false},
+		{"rational to rounded decimal", ModeRational, Operation{Mode: ModeDecimal, Precision: 5, Rounding: decimal.HalfEven}, Operand{Exact: "2/3"}, "0.66667", false},
+		{"rational to integer", ModeRational, Operation{Mode: ModeInteger}, Operand{Value: 3, Exact: "3"}, "3", false},
+		{"fraction to integer", ModeRational, Operation{Mode: ModeInteger}, Operand{Value: 0.3, Exact: "3/10"}, "", true},
+		{"decimal to rational", ModeDecimal, Operation{Mode: ModeRational}, Operand{Value: 1.25, Exact: "1.25"}, "5/4", false},
+		{"float to rational", ModeFloat, Operation{Mode: ModeRational}, Operand{Value: 0.1}, "1/10", false},
+		{"integer to complex", ModeInteger, Operation{Mode: ModeComplex}, Operand{Value: 2, Exact: "2"}, "2+0i", false},
+		{"real complex to rational", ModeComplex, Operation{Mode: ModeRational}, Operand{Value: 0.5, Exact: "0.5+0i"}, "1/2", false},
+		{"complex to float", ModeComplex, Operation{Mode: ModeFloat}, Operand{Exact: "0+1i"}, "", true},
+		{"same mode", ModeRational, Operation{Mode: ModeRational}, Operand{Exact: "1/3"}, "1/3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.to.Convert(tt.from, tt.x)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Convert() = %+v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Convert() returned error: %s", err)
+			}
+			if got.Exact != tt.want {
+				t.Errorf("Convert() = %q, want %q", got.Exact, tt.want)
+			}
+		})
+	}
+}
@@ -1,6 +1,12 @@
 package operation
 
-import "time"
+import (
+	"fmt"
+	"math"
+	"math-calc/internal/decimal"
+	"strings"
+	"time"
+)
 
 // ID is a unique identifier of an operation.
 type ID int64
@@ -14,6 +20,37 @@ const (
 	Subtraction Operator = "-"
 	Multiply    Operator = "*"
 	Division    Operator = "/"
+	// FloorDivision rounds the quotient towards negative infinity.
+	FloorDivision Operator = "//"
+	// Modulo is the remainder of FloorDivision, so it has the sign of the right operand.
+	Modulo Operator = "%"
+	Power  Operator = "^"
+	// Negation is a unary operation. It has a single operand.
+	Negation Operator = "neg"
+
+	// Comparisons and logical operators result in 1 if true and 0 if false.
+	// Any non-zero operand is considered true.
+	Equal        Operator = "=="
+	NotEqual     Operator = "!="
+	Less         Operator = "<"
+	LessEqual    Operator = "<="
+	Greater      Operator = ">"
+	GreaterEqual Operator = ">="
+	And          Operator = "&&"
+	Or           Operator = "||"
+	// Not is a unary operation. It has a single operand.
+	Not Operator = "!"
+
+	// Conditional has three operands: a condition and results for true and false conditions.
+	// Operations of both branches are created in StateDeferred. The orchestrator resolves the conditional
+	// itself: it activates the chosen branch and skips the other one, so it never reaches a worker.
+	Conditional Operator = "if"
+
+	// Dot is the dot product of vectors, or the matrix product if one of the operands is a matrix.
+	Dot Operator = "."
+	// PackArray has any number of operands and results in an array of them, see Pack.
+	// It is created for array literals which elements have to be calculated, e.g. [x+1, 2].
+	PackArray Operator = "array"
 )
 
 const (
@@ -21,7 +58,7 @@ const (
 	// Orchestrator should change the state to either StateScheduled or StatePending immediately.
 	StateCreated State = iota
 	// StateScheduled means that some other operations have to be completed to start this one.
-	// In this case, LeftOperationID or RightOperationID is not empty.
+	// In this case, OperationID of at least one operand is not empty.
 	StateScheduled
 	// StatePending means that the operation is ready to be processed by a worker.
 	StatePending
@@ -30,35 +67,144 @@ const (
 	// StateDone means that the operation has been completed successfully.
 	// In this case, Result is not empty.
 	StateDone
-	// StateError means that either this operation, LeftOperationID or RightOperationID has failed.
+	// StateError means that either this operation or one of the operations it depends on has failed.
 	// In this case, Error is not empty.
 	StateError
+	// StateDeferred means that the operation belongs to a branch of a Conditional which hasn't been chosen yet.
+	// The orchestrator changes the state to StateCreated once the branch is chosen.
+	StateDeferred
+	// StateSkipped means that the operation belongs to a branch of a Conditional which wasn't chosen.
+	// It is never calculated.
+	StateSkipped
 )
 
 type Operation struct {
 	Id      ID
 	OwnerID int
-	// Op represents type of operation that is performed on left and right values.
-	Op          Operator
+	// Op represents type of operation that is performed on Operands.
+	Op Operator
+	// Mode is the kind of numbers used to calculate the operation.
+	Mode Mode
+	// Precision is the number of significant digits of the result in ModeDecimal.
+	Precision int
+	// Rounding is the rounding mode used in ModeDecimal.
+	Rounding    decimal.RoundingMode
 	State       State
 	CreatedTime time.Time
 	// FinishedTime is empty while State is not StateDone or StateError.
 	FinishedTime time.Time
 
-	// Left is the value of left operand. It can be empty if LeftOperationID is set.
-	Left float64
-	// Right is the value of right operand. It can be empty if RightOperationID is set.
-	Right float64
+	// Priority is set for all operations of an expression. Pending operations with higher priority are calculated first.
+	Priority int
+	// CriticalPath is the number of operations of the expression which can start only after this one
+	// on the longest chain to its root. Among pending operations of equal priority, longer chains go first.
+	CriticalPath int
 
-	// LeftOperationID is the ID of the operation which result is used as left operand.
-	LeftOperationID ID
-	// RightOperationID is the ID of the operation which result is used as right operand.
-	RightOperationID ID
+	// Operands are the arguments of Op in order. Binary operators have exactly two of them.
+	Operands []Operand
 
 	Result float64
-	Error  string
+	// ResultExact is the lossless form of Result in modes other than ModeFloat, see Operand.Exact.
+	ResultExact string
+	Error       string
 
 	// Expression field can be set in order to store the original expression.
 	// This doesn't influence orchestrator and workers in any way.
 	Expression string
+	// Variables are the bindings substituted into Expression. Like Expression, it is informational only.
+	Variables map[string]float64
+}
+
+// Operand is an argument of an operation. It is either a literal value or a result of another operation.
+type Operand struct {
+	// Value is the literal value of the operand. It is empty while OperationID is set.
+	// In modes other than ModeFloat, it is an approximation of Exact.
+	Value float64
+	// Exact is the lossless text form of the value used by modes other than ModeFloat.
+	// If it is empty, the value is taken from Value.
+	// Arrays are stored in Exact in every mode, Value is empty then, see Array.
+	Exact string
+	// OperationID is the ID of the operation which result is used as the operand.
+	// The orchestrator replaces it with Value once that operation is done.
+	OperationID ID
+	// Origin is the ID of the operation the operand was taken from, kept after OperationID is cleared.
+	// Like Operation.Expression, it is informational only.
+	Origin ID
+}
+
+// Detach returns the operand which doesn't wait for the operation it refers to anymore.
+// The operation is still remembered in Origin.
+func (o Operand) Detach() Operand {
+	if o.OperationID != 0 {
+		o.Origin = o.OperationID
+		o.OperationID = 0
+	}
+	return o
+}
+
+// Key identifies an operation by its operator and operands. Operations with equal keys
+// and equal arithmetic settings have equal results.
+func Key(op Operator, operands []Operand) string {
+	var b strings.Builder
+	b.WriteString(string(op))
+	for _, operand := range operands {
+		switch {
+		case operand.OperationID != 0:
+			fmt.Fprintf(&b, " #%d", operand.OperationID)
+		case operand.Exact != "":
+			fmt.Fprintf(&b, " =%s", operand.Exact)
+		default:
+			fmt.Fprintf(&b, " ~%x", math.Float64bits(operand.Value))
+		}
+	}
+	return b.String()
+}
+
+// Key identifies the operation by its arithmetic settings, operator and operands, see Key.
+func (o Operation) Key() string {
+	return fmt.Sprintf("%s/%d/%s %s", o.Mode, o.Precision, o.Rounding, Key(o.Op, o.Operands))
+}
+
+// HasDependencies reports whether any operand still waits for another operation.
+func (o Operation) HasDependencies() bool {
+	for _, operand := range o.Operands {
+		if operand.OperationID != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// DependsOn reports whether any operand waits for the operation with the given id.
+func (o Operation) DependsOn(id ID) bool {
+	for _, operand := range o.Operands {
+		if operand.OperationID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ResultOperand returns the result of the operation as a literal operand.
+func (o Operation) ResultOperand() Operand {
+	return Operand{Value: o.Result, Exact: o.ResultExact}
+}
+
+// Substitute replaces every operand waiting for the operation with the given id by its result.
+func (o *Operation) Substitute(id ID, result Operand) {
+	for i := range o.Operands {
+		if o.Operands[i].OperationID == id {
+			o.Operands[i] = result
+			o.Operands[i].Origin = id
+		}
+	}
+}
+
+// Values returns values of all operands.
+func (o Operation) Values() []float64 {
+	values := make([]float64, len(o.Operands))
+	for i, operand := range o.Operands {
+		values[i] = operand.Value
+	}
+	return values
 }
@@ -0,0 +1,319 @@
+package orchestrator
+
+import (
+	"fmt"
+	"math-calc/internal/operation"
+	"strings"
+)
+
+// arrayOperators are defined only for arrays.
+var arrayOperators = map[operation.Operator]bool{
+	operation.Dot:       true,
+	operation.PackArray: true,
+	"det":               true,
+	"transpose":         true,
+}
+
+// reductions are the variadic functions which are applied to the elements of all their arguments together,
+// e.g. sum([1, 2, 3]) is 6 and max([1, 2], 3) is 3. They are never applied element-wise.
+var reductions = map[operation.Operator]bool{
+	"sum": true,
+	"avg": true,
+	"min": true,
+	"max": true,
+	"gcd": true,
+	"lcm": true,
+}
+
+// isArrayOperation reports whether op has to be calculated by calculateArray.
+func isArrayOperation(op operation.Operation) bool {
+	if arrayOperators[op.Op] {
+		return true
+	}
+	for _, operand := range op.Operands {
+		if operand.IsArray() {
+			return true
+		}
+	}
+	return false
+}
+
+// calculateArray calculates operations on vectors and matrices.
+// Other operators and functions except reductions are applied element-wise, and numbers are combined
+// with every element of arrays.
+func calculateArray(op operation.Operation) (operation.Operand, error) {
+	switch op.Op {
+	case operation.PackArray:
+		return operation.Pack(op.Mode, op.Operands)
+	case operation.Dot:
+		return dotProduct(op)
+	case "det":
+		return determinant(op)
+	case "transpose":
+		return transpose(op)
+	case operation.Conditional:
+		// Branches may be arrays, the condition can't
+		return calculateLogical(op)
+	}
+
+	if reductions[op.Op] {
+		return reduce(op)
+	}
+	return elementWise(op)
+}
+
+// reduce applies a reduction to the elements of all arrays and the numbers among the operands of op.
+func reduce(op operation.Operation) (operation.Operand, error) {
+	var elems []operation.Operand
+	for _, operand := range op.Operands {
+		if !operand.IsArray() {
+			elems = append(elems, operand)
+			continue
+		}
+		a, err := operand.Array(op.Mode)
+		if err != nil {
+			return operation.Operand{}, err
+		}
+		elems = append(elems, a.Elems...)
+	}
+	return apply(op, op.Op, elems...)
+}
+
+// apply calculates a scalar operation with the settings of op.
+func apply(op operation.Operation, operator operation.Operator, operands ...operation.Operand) (operation.Operand, error) {
+	op.Op = operator
+	op.Operands = operands
+	return Calculate(op, 0)
+}
+
+func elementWise(op operation.Operation) (operation.Operand, error) {
+	arrays := make([]operation.Array, len(op.Operands))
+	var shape operation.Array
+	first := -1
+	for i, operand := range op.Operands {
+		if !operand.IsArray() {
+			continue
+		}
+		a, err := operand.Array(op.Mode)
+		if err != nil {
+			return operation.Operand{}, err
+		}
+		if first != -1 && a.ShapeString() != shape.ShapeString() {
+			return operation.Operand{}, fmt.Errorf("dimension mismatch: %s can't be applied to %s and %s",
+				op.Op, describeOperand(op.Mode, op.Operands[first]), describeOperand(op.Mode, operand))
+		}
+		if first == -1 {
+			first = i
+		}
+		arrays[i], shape = a, a
+	}
+
+	result := operation.Array{Shape: shape.Shape, Elems: make([]operation.Operand, shape.Len())}
+	operands := make([]operation.Operand, len(op.Operands))
+	for i := range result.Elems {
+		for j, operand := range op.Operands {
+			operands[j] = operand
+			if operand.IsArray() {
+				operands[j] = arrays[j].Elems[i]
+			}
+		}
+
+		var err error
+		result.Elems[i], err = apply(op, op.Op, operands...)
+		if err != nil {
+			return operation.Operand{}, fmt.Errorf("element %s: %w", elementIndex(shape.Shape, i), err)
+		}
+		if result.Elems[i].IsArray() {
+			return operation.Operand{}, fmt.Errorf("element %s: arrays can't be nested", elementIndex(shape.Shape, i))
+		}
+	}
+	return operation.ArrayOperand(op.Mode, result)
+}
+
+// elementIndex returns the 1-based position of the i-th element of an array of the shape, e.g. [2, 1].
+func elementIndex(shape []int, i int) string {
+	index := make([]string, len(shape))
+	for d := len(shape) - 1; d >= 0; d-- {
+		index[d] = fmt.Sprint(i%shape[d] + 1)
+		i /= shape[d]
+	}
+	return "[" + strings.Join(index, ", ") + "]"
+}
+
+// describeOperand returns the kind of the operand for error messages, e.g. "a 2x3 matrix".
+func describeOperand(mode operation.Mode, x operation.Operand) string {
+	if !x.IsArray() {
+		return "a number"
+	}
+	a, err := x.Array(mode)
+	if err != nil {
+		return "a malformed array"
+	}
+	if len(a.Shape) == 1 {
+		return fmt.Sprintf("a vector of length %d", a.Shape[0])
+	}
+	return fmt.Sprintf("a %s matrix", a.ShapeString())
+}
+
+// dotProduct multiplies vectors and matrices. Vectors are rows on the left side and columns on the right side,
+// so the product of vectors is their dot product.
+func dotProduct(op operation.Operation) (operation.Operand, error) {
+	x, y := op.Operands[0], op.Operands[1]
+	if !x.IsArray() || !y.IsArray() {
+		return operation.Operand{}, fmt.Errorf("operator . expects vectors or matrices, got %s and %s", describeOperand(op.Mode, x), describeOperand(op.Mode, y))
+	}
+	a, err := x.Array(op.Mode)
+	if err != nil {
+		return operation.Operand{}, err
+	}
+	b, err := y.Array(op.Mode)
+	if err != nil {
+		return operation.Operand{}, err
+	}
+
+	rows, inner := 1, a.Shape[0]
+	if len(a.Shape) == 2 {
+		rows, inner = a.Shape[0], a.Shape[1]
+	}
+	bInner, cols := b.Shape[0], 1
+	if len(b.Shape) == 2 {
+		cols = b.Shape[1]
+	}
+	if inner != bInner {
+		return operation.Operand{}, fmt.Errorf("dimension mismatch: %s can't be multiplied by %s", describeOperand(op.Mode, x), describeOperand(op.Mode, y))
+	}
+
+	result := operation.Array{Elems: make([]operation.Operand, 0, rows*cols)}
+	for i := 0; i < rows; i++ {
+		for j := 0; j < cols; j++ {
+			var sum operation.Operand
+			for k := 0; k < inner; k++ {
+				product, err := apply(op, operation.Multiply, a.Elems[i*inner+k], b.Elems[k*cols+j])
+				if err != nil {
+					return operation.Operand{}, err
+				}
+				if k == 0 {
+					sum = product
+					continue
+				}
+				sum, err = apply(op, operation.Addition, sum, product)
+				if err != nil {
+					return operation.Operand{}, err
+				}
+			}
+			result.Elems = append(result.Elems, sum)
+		}
+	}
+
+	switch {
+	case len(a.Shape) == 1 && len(b.Shape) == 1:
+		return result.Elems[0], nil
+	case len(a.Shape) == 1:
+		result.Shape = []int{cols}
+	case len(b.Shape) == 1:
+		result.Shape = []int{rows}
+	default:
+		result.Shape = []int{rows, cols}
+	}
+	return operation.ArrayOperand(op.Mode, result)
+}
+
+// squareMatrix returns the only operand of op, which has to be a square matrix.
+func squareMatrix(op operation.Operation) (operation.Array, error) {
+	x := op.Operands[0]
+	if x.IsArray() {
+		a, err := x.Array(op.Mode)
+		if err != nil {
+			return operation.Array{}, err
+		}
+		if len(a.Shape) == 2 && a.Shape[0] == a.Shape[1] {
+			return a, nil
+		}
+	}
+	return operation.Array{}, fmt.Errorf("%s expects a square matrix, got %s", op.Op, describeOperand(op.Mode, x))
+}
+
+// determinant uses the Bareiss algorithm. Its divisions are exact, so it works in integer mode too.
+func determinant(op operation.Operation) (operation.Operand, error) {
+	a, err := squareMatrix(op)
+	if err != nil {
+		return operation.Operand{}, err
+	}
+	n := a.Shape[0]
+	m := make([][]operation.Operand, n)
+	for i := range m {
+		m[i] = a.Elems[i*n : (i+1)*n]
+	}
+
+	negative := false
+	prev, _ := operation.Literal(op.Mode, "1")
+	for k := 0; k < n-1; k++ {
+		// A zero pivot is swapped with a row below
+		pivot := -1
+		for i := k; i < n && pivot == -1; i++ {
+			nonZero, err := operation.Truth(op.Mode, m[i][k])
+			if err != nil {
+				return operation.Operand{}, err
+			}
+			if nonZero {
+				pivot = i
+			}
+		}
+		if pivot == -1 {
+			return operation.Literal(op.Mode, "0")
+		}
+		if pivot != k {
+			m[k], m[pivot] = m[pivot], m[k]
+			negative = !negative
+		}
+
+		for i := k + 1; i < n; i++ {
+			row := make([]operation.Operand, n)
+			copy(row, m[i])
+			for j := k + 1; j < n; j++ {
+				// m[i][j] = (m[i][j] * m[k][k] - m[i][k] * m[k][j]) / prev
+				x, err := apply(op, operation.Multiply, m[i][j], m[k][k])
+				if err != nil {
+					return operation.Operand{}, err
+				}
+				y, err := apply(op, operation.Multiply, m[i][k], m[k][j])
+				if err != nil {
+					return operation.Operand{}, err
+				}
+				x, err = apply(op, operation.Subtraction, x, y)
+				if err != nil {
+					return operation.Operand{}, err
+				}
+				row[j], err = apply(op, operation.Division, x, prev)
+				if err != nil {
+					return operation.Operand{}, err
+				}
+			}
+			m[i] = row
+		}
+		prev = m[k][k]
+	}
+
+	result := m[n-1][n-1]
+	if negative {
+		return apply(op, operation.Negation, result)
+	}
+	return result, nil
+}
+
+func transpose(op operation.Operation) (operation.Operand, error) {
+	x := op.Operands[0]
+	a, err := x.Array(op.Mode)
+	if err != nil || len(a.Shape) != 2 {
+		return operation.Operand{}, fmt.Errorf("transpose expects a matrix, got %s", describeOperand(op.Mode, x))
+	}
+
+	rows, cols := a.Shape[0], a.Shape[1]
+	result := operation.Array{Shape: []int{cols, rows}, Elems: make([]operation.Operand, 0, len(a.Elems))}
+	for j := 0; j < cols; j++ {
+		for i := 0; i < rows; i++ {
+			result.Elems = append(result.Elems, a.Elems[i*cols+j])
+		}
+	}
+	return operation.ArrayOperand(op.Mode, result)
+}
@@ -0,0 +1,47 @@
+package orchestrator
+
+import (
+	"math-calc/internal/operation"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestCalculateArray(t *testing.T) {
+	vector := func(elems ...string) operation.Operand {
+		return operation.Operand{Exact: `["` + strings.Join(elems, `","`) + `"]`}
+	}
+
+	tests := []struct {
+		name     string
+		op       operation.Operator
+		operands []operation.Operand
+		want     string
+	}{
+		{"sum of a vector", "sum", []operation.Operand{vector("1", "2", "3")}, "6"},
+		{"sum of vectors and numbers", "sum", []operation.Operand{vector("1", "2"), vector("3", "4"), {Value: 5}}, "15"},
+		{"max of a vector and a number", "max", []operation.Operand{vector("1", "2"), {Value: 3}}, "3"},
+		{"min of a vector and a number", "min", []operation.Operand{vector("1", "2"), {Value: 3}}, "1"},
+		{"avg of vectors", "avg", []operation.Operand{vector("1", "2"), vector("3", "6")}, "3"},
+		{"element-wise product", operation.Multiply, []operation.Operand{vector("1", "2"), {Value: 3}}, `["3","6"]`},
+		{"element-wise function", "sqrt", []operation.Operand{vector("4", "9")}, `["2","3"]`},
+		{"dot product", operation.Dot, []operation.Operand{vector("1", "2", "3"), vector("4", "5", "6")}, "32"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := operation.Operation{Op: tt.op, Mode: operation.ModeFloat, Operands: tt.operands}
+			result, err := Calculate(op, 0)
+			if err != nil {
+				t.Fatalf("Calculate() returned error: %s", err)
+			}
+			got := result.Exact
+			if got == "" {
+				got = strconv.FormatFloat(result.Value, 'g', -1, 64)
+			}
+			if got != tt.want {
+				t.Errorf("Calculate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
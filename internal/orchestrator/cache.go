@@ -0,0 +1,100 @@
+package orchestrator
+
+import (
+	"container/list"
+	"math-calc/internal/operation"
+	"sync"
+	"time"
+)
+
+// resultCache is an LRU cache of operation results keyed by operation.Operation.Key,
+// so that operations with identical inputs are calculated once across all expressions.
+// A nil cache is disabled: it never hits.
+type resultCache struct {
+	mx      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[string]*list.Element
+	// order holds cacheEntry values, most recently used first.
+	order *list.List
+
+	hits   uint64
+	misses uint64
+}
+
+type cacheEntry struct {
+	key    string
+	result operation.Operand
+	stored time.Time
+}
+
+// newResultCache returns a cache of the given size. Results expire after ttl, unless it is 0.
+// It returns nil if size is not positive.
+func newResultCache(size int, ttl time.Duration) *resultCache {
+	if size <= 0 {
+		return nil
+	}
+	return &resultCache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+	}
+}
+
+// get returns the cached result of an operation with the given key.
+func (c *resultCache) get(key string) (operation.Operand, bool) {
+	if c == nil {
+		return operation.Operand{}, false
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	elem, ok := c.entries[key]
+	if ok && c.ttl > 0 && time.Since(elem.Value.(cacheEntry).stored) > c.ttl {
+		c.order.Remove(elem)
+		delete(c.entries, key)
+		ok = false
+	}
+	if !ok {
+		c.misses++
+		return operation.Operand{}, false
+	}
+
+	c.hits++
+	c.order.MoveToFront(elem)
+	return elem.Value.(cacheEntry).result, true
+}
+
+// put stores the result of an operation with the given key, evicting the least recently used one if the cache is full.
+func (c *resultCache) put(key string, result operation.Operand) {
+	if c == nil {
+		return
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	entry := cacheEntry{key: key, result: result, stored: time.Now()}
+	if elem, ok := c.entries[key]; ok {
+		elem.Value = entry
+		c.order.MoveToFront(elem)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(cacheEntry).key)
+	}
+}
+
+// stats returns the number of cache hits and misses.
+func (c *resultCache) stats() (hits, misses uint64) {
+	if c == nil {
+		return 0, 0
+	}
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	return c.hits, c.misses
+}
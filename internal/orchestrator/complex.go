@@ -0,0 +1,150 @@
+package orchestrator
+
+import (
+	"fmt"
+	"math"
+	"math-calc/internal/operation"
+	"math/cmplx"
+)
+
+// maxComplexIntExponent is the largest integer power computed by squaring in complex mode.
+const maxComplexIntExponent = 1 << 20
+
+var complexFunctions = map[operation.Operator]func(args []complex128) (complex128, error){
+	"sqrt": complexUnary(cmplx.Sqrt),
+	"exp":  complexUnary(cmplx.Exp),
+	"ln":   complexLogarithm(cmplx.Log),
+	"log":  complexLogarithm(cmplx.Log10),
+	"log2": complexLogarithm(func(x complex128) complex128 {
+		return cmplx.Log(x) / math.Ln2
+	}),
+	"sin":  complexUnary(cmplx.Sin),
+	"cos":  complexUnary(cmplx.Cos),
+	"tan":  complexUnary(cmplx.Tan),
+	"asin": complexUnary(cmplx.Asin),
+	"acos": complexUnary(cmplx.Acos),
+	"atan": complexUnary(cmplx.Atan),
+	"abs": complexUnary(func(x complex128) complex128 {
+		return complex(cmplx.Abs(x), 0)
+	}),
+	"re": complexUnary(func(x complex128) complex128 {
+		return complex(real(x), 0)
+	}),
+	"im": complexUnary(func(x complex128) complex128 {
+		return complex(imag(x), 0)
+	}),
+	"conj": complexUnary(cmplx.Conj),
+	"arg": complexUnary(func(x complex128) complex128 {
+		return complex(cmplx.Phase(x), 0)
+	}),
+	"sum": func(args []complex128) (complex128, error) {
+		return complexSum(args), nil
+	},
+	"avg": func(args []complex128) (complex128, error) {
+		return complexSum(args) / complex(float64(len(args)), 0), nil
+	},
+}
+
+func complexUnary(f func(complex128) complex128) func([]complex128) (complex128, error) {
+	return func(args []complex128) (complex128, error) {
+		return f(args[0]), nil
+	}
+}
+
+func complexLogarithm(f func(complex128) complex128) func([]complex128) (complex128, error) {
+	return func(args []complex128) (complex128, error) {
+		if args[0] == 0 {
+			return 0, fmt.Errorf("logarithm of zero")
+		}
+		return f(args[0]), nil
+	}
+}
+
+func calculateComplex(op operation.Operator, operands []operation.Operand) (operation.Operand, error) {
+	args := make([]complex128, len(operands))
+	for i, operand := range operands {
+		var err error
+		args[i], err = operand.Complex()
+		if err != nil {
+			return operation.Operand{}, err
+		}
+	}
+
+	result, err := applyComplex(op, args)
+	if err != nil {
+		return operation.Operand{}, err
+	}
+	if cmplx.IsNaN(result) {
+		return operation.Operand{}, fmt.Errorf("result is undefined")
+	}
+	return operation.ComplexOperand(result), nil
+}
+
+func applyComplex(op operation.Operator, args []complex128) (complex128, error) {
+	if fn, ok := operation.LookupFunction(string(op)); ok {
+		f, ok := complexFunctions[fn.Name]
+		if !ok {
+			return 0, fmt.Errorf("function %s is not supported in complex mode", fn.Name)
+		}
+		result, err := f(args)
+		if err != nil {
+			return 0, fmt.Errorf("%s: %w", fn.Name, err)
+		}
+		return result, nil
+	}
+
+	if op == operation.Negation {
+		return 0 - args[0], nil
+	}
+	left, right := args[0], args[1]
+
+	switch op {
+	case operation.Addition:
+		return left + right, nil
+	case operation.Subtraction:
+		return left - right, nil
+	case operation.Multiply:
+		return left * right, nil
+	case operation.Division:
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return left / right, nil
+	case operation.Power:
+		if left == 0 && real(right) < 0 {
+			return 0, fmt.Errorf("zero raised to a negative power")
+		}
+		return complexPow(left, right), nil
+	}
+	return 0, fmt.Errorf("operation %s is not supported in complex mode", op)
+}
+
+// complexPow raises base to a power. Small integer powers are computed by squaring,
+// so that e.g. i^2 is exactly -1 rather than an approximation from cmplx.Pow.
+func complexPow(base, exponent complex128) complex128 {
+	n := real(exponent)
+	if imag(exponent) != 0 || n != math.Trunc(n) || math.Abs(n) > maxComplexIntExponent {
+		return cmplx.Pow(base, exponent)
+	}
+
+	result := complex(1, 0)
+	square := base
+	for e := int64(math.Abs(n)); e > 0; e >>= 1 {
+		if e&1 == 1 {
+			result *= square
+		}
+		square *= square
+	}
+	if n < 0 {
+		return 1 / result
+	}
+	return result
+}
+
+func complexSum(args []complex128) complex128 {
+	var sum complex128
+	for _, arg := range args {
+		sum += arg
+	}
+	return sum
+}
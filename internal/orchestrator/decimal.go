@@ -0,0 +1,233 @@
+package orchestrator
+
+import (
+	"fmt"
+	"math-calc/internal/decimal"
+	"math-calc/internal/operation"
+	"math/big"
+)
+
+const (
+	// maxDecimalExponent limits powers in decimal mode, so a single operation can't take forever.
+	maxDecimalExponent = 100000
+	// maxDecimalMagnitude limits adjusted exponents of operands and results in decimal mode,
+	// so that writing them out or aligning them for addition can't exhaust memory.
+	maxDecimalMagnitude = 100000
+)
+
+// decimalContext holds the precision and the rounding mode of a decimal operation.
+type decimalContext struct {
+	prec     int
+	rounding decimal.RoundingMode
+}
+
+func (c decimalContext) round(d decimal.Decimal) decimal.Decimal {
+	return d.Round(c.prec, c.rounding)
+}
+
+var decimalFunctions = map[operation.Operator]func(c decimalContext, args []decimal.Decimal) (decimal.Decimal, error){
+	"sqrt": func(c decimalContext, args []decimal.Decimal) (decimal.Decimal, error) {
+		if args[0].Sign() < 0 {
+			return decimal.Decimal{}, fmt.Errorf("square root of negative number %s", args[0])
+		}
+		return args[0].Sqrt(c.prec, c.rounding), nil
+	},
+	"abs": func(c decimalContext, args []decimal.Decimal) (decimal.Decimal, error) {
+		return c.round(args[0].Abs()), nil
+	},
+	"floor": func(c decimalContext, args []decimal.Decimal) (decimal.Decimal, error) {
+		return c.round(args[0].Floor()), nil
+	},
+	"ceil": func(c decimalContext, args []decimal.Decimal) (decimal.Decimal, error) {
+		return c.round(args[0].Ceil()), nil
+	},
+	"round": func(c decimalContext, args []decimal.Decimal) (decimal.Decimal, error) {
+		// Rounding to an integer follows the rounding mode of the expression
+		return c.round(args[0].RoundToInt(c.rounding)), nil
+	},
+	"re": func(c decimalContext, args []decimal.Decimal) (decimal.Decimal, error) {
+		return c.round(args[0]), nil
+	},
+	"im": func(c decimalContext, args []decimal.Decimal) (decimal.Decimal, error) {
+		return decimal.Decimal{}, nil
+	},
+	"conj": func(c decimalContext, args []decimal.Decimal) (decimal.Decimal, error) {
+		return c.round(args[0]), nil
+	},
+	"min": func(c decimalContext, args []decimal.Decimal) (decimal.Decimal, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(result) < 0 {
+				result = arg
+			}
+		}
+		return c.round(result), nil
+	},
+	"max": func(c decimalContext, args []decimal.Decimal) (decimal.Decimal, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(result) > 0 {
+				result = arg
+			}
+		}
+		return c.round(result), nil
+	},
+	"sum": func(c decimalContext, args []decimal.Decimal) (decimal.Decimal, error) {
+		return c.round(decimalSum(args)), nil
+	},
+	"avg": func(c decimalContext, args []decimal.Decimal) (decimal.Decimal, error) {
+		count, _ := decimal.Parse(fmt.Sprint(len(args)))
+		return decimalSum(args).Quo(count, c.prec, c.rounding), nil
+	},
+}
+
+func calculateDecimal(op operation.Operation) (operation.Operand, error) {
+	c := decimalContext{prec: op.Precision, rounding: op.Rounding}
+	if c.prec <= 0 {
+		c.prec = operation.DefaultPrecision
+	}
+	if c.rounding == "" {
+		c.rounding = decimal.HalfEven
+	}
+
+	args := make([]decimal.Decimal, len(op.Operands))
+	for i, operand := range op.Operands {
+		var err error
+		args[i], err = operand.Decimal()
+		if err != nil {
+			return operation.Operand{}, err
+		}
+		if err := checkDecimalMagnitude(args[i]); err != nil {
+			return operation.Operand{}, fmt.Errorf("operand %d: %w", i+1, err)
+		}
+	}
+
+	result, err := applyDecimal(c, op.Op, args)
+	if err != nil {
+		return operation.Operand{}, err
+	}
+	if err := checkDecimalMagnitude(result); err != nil {
+		return operation.Operand{}, fmt.Errorf("result %w", err)
+	}
+	return operation.DecimalOperand(result), nil
+}
+
+// checkDecimalMagnitude returns an error if d is out of the range limited by maxDecimalMagnitude.
+func checkDecimalMagnitude(d decimal.Decimal) error {
+	if exp := d.AdjustedExp(); exp > maxDecimalMagnitude {
+		return fmt.Errorf("is too large")
+	} else if exp < -maxDecimalMagnitude {
+		return fmt.Errorf("is too close to zero")
+	}
+	return nil
+}
+
+func applyDecimal(c decimalContext, op operation.Operator, args []decimal.Decimal) (decimal.Decimal, error) {
+	if fn, ok := operation.LookupFunction(string(op)); ok {
+		f, ok := decimalFunctions[fn.Name]
+		if !ok {
+			return decimal.Decimal{}, fmt.Errorf("function %s is not supported in decimal mode", fn.Name)
+		}
+		result, err := f(c, args)
+		if err != nil {
+			return decimal.Decimal{}, fmt.Errorf("%s: %w", fn.Name, err)
+		}
+		return result, nil
+	}
+
+	if op == operation.Negation {
+		return c.round(args[0].Neg()), nil
+	}
+	left, right := args[0], args[1]
+
+	switch op {
+	case operation.Addition:
+		return c.round(left.Add(right)), nil
+	case operation.Subtraction:
+		return c.round(left.Sub(right)), nil
+	case operation.Multiply:
+		return c.round(left.Mul(right)), nil
+	case operation.Division:
+		if right.Sign() == 0 {
+			return decimal.Decimal{}, fmt.Errorf("division by zero")
+		}
+		return left.Quo(right, c.prec, c.rounding), nil
+	case operation.FloorDivision:
+		if right.Sign() == 0 {
+			return decimal.Decimal{}, fmt.Errorf("division by zero")
+		}
+		return c.round(left.FloorQuo(right)), nil
+	case operation.Modulo:
+		if right.Sign() == 0 {
+			return decimal.Decimal{}, fmt.Errorf("modulo by zero")
+		}
+		return c.round(left.Sub(left.FloorQuo(right).Mul(right))), nil
+	case operation.Power:
+		return decimalPow(c, left, right)
+	}
+	return decimal.Decimal{}, fmt.Errorf("unknown operation %s", op)
+}
+
+// decimalPow raises base to an integer power by squaring, rounding intermediate results with extra digits.
+func decimalPow(c decimalContext, base, exponent decimal.Decimal) (decimal.Decimal, error) {
+	if !exponent.IsInt() {
+		return decimal.Decimal{}, fmt.Errorf("non-integer power %s is not supported in decimal mode", exponent)
+	}
+	n := exponent.Int()
+	if !n.IsInt64() || n.Int64() > maxDecimalExponent || n.Int64() < -maxDecimalExponent {
+		return decimal.Decimal{}, fmt.Errorf("exponent %s is too large, the limit is %d", exponent, maxDecimalExponent)
+	}
+	if base.Sign() == 0 && n.Sign() < 0 {
+		return decimal.Decimal{}, fmt.Errorf("zero raised to a negative power")
+	}
+
+	work := decimalContext{prec: c.prec + 10, rounding: decimal.HalfEven}
+	result, _ := decimal.Parse("1")
+	e := n.Int64()
+	if e < 0 {
+		e = -e
+	}
+	// All factors are powers of base, so once one of them is out of range, the result is too.
+	// Checking them keeps exponents of the intermediate results small.
+	for square := base; ; {
+		if e&1 == 1 {
+			result = work.round(result.Mul(square))
+			if err := checkDecimalPower(result, n); err != nil {
+				return decimal.Decimal{}, err
+			}
+		}
+		if e >>= 1; e == 0 {
+			break
+		}
+		square = work.round(square.Mul(square))
+		if err := checkDecimalPower(square, n); err != nil {
+			return decimal.Decimal{}, err
+		}
+	}
+
+	if n.Sign() < 0 {
+		one, _ := decimal.Parse("1")
+		return one.Quo(result, c.prec, c.rounding), nil
+	}
+	return c.round(result), nil
+}
+
+// checkDecimalPower checks an intermediate result of raising to the power n, see decimalPow.
+// For negative n the result is inverted, so a large intermediate result means that it is close to zero.
+func checkDecimalPower(d decimal.Decimal, n *big.Int) error {
+	if n.Sign() < 0 {
+		d = decimal.FromInt(big.NewInt(1)).Quo(d, 1, decimal.HalfEven)
+	}
+	if err := checkDecimalMagnitude(d); err != nil {
+		return fmt.Errorf("result %w", err)
+	}
+	return nil
+}
+
+func decimalSum(args []decimal.Decimal) decimal.Decimal {
+	var sum decimal.Decimal
+	for _, arg := range args {
+		sum = sum.Add(arg)
+	}
+	return sum
+}
@@ -0,0 +1,47 @@
+package orchestrator
+
+import (
+	"math-calc/internal/operation"
+	"testing"
+)
+
+func TestCalculateDecimalLimits(t *testing.T) {
+	calculate := func(op operation.Operator, operands ...operation.Operand) (operation.Operand, error) {
+		return calculateDecimal(operation.Operation{Mode: operation.ModeDecimal, Op: op, Operands: operands})
+	}
+
+	tests := []struct {
+		name     string
+		op       operation.Operator
+		operands []operation.Operand
+		want     string
+		err      string
+	}{
+		{"large power", operation.Power, []operation.Operand{{Exact: "1e10"}, {Exact: "10000"}}, "1e100000", ""},
+		{"power out of range", operation.Power, []operation.Operand{{Exact: "1e10000"}, {Exact: "1000"}}, "", "result is too large"},
+		{"power of a large result", operation.Power, []operation.Operand{{Exact: "1e99999"}, {Exact: "100000"}}, "", "result is too large"},
+		{"negative power out of range", operation.Power, []operation.Operand{{Exact: "1e10000"}, {Exact: "-1000"}}, "", "result is too close to zero"},
+		{"small power out of range", operation.Power, []operation.Operand{{Exact: "1e-10000"}, {Exact: "1000"}}, "", "result is too close to zero"},
+		{"product out of range", operation.Multiply, []operation.Operand{{Exact: "1e60000"}, {Exact: "1e60000"}}, "", "result is too large"},
+		{"large operand", operation.Addition, []operation.Operand{{Exact: "1e100001"}, {Exact: "1"}}, "", "operand 1: is too large"},
+		{"sum at the limit", operation.Addition, []operation.Operand{{Exact: "1e99999"}, {Exact: "9e99999"}}, "1e100000", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := calculate(tt.op, tt.operands...)
+			if tt.err != "" {
+				if err == nil || err.Error() != tt.err {
+					t.Errorf("calculateDecimal(%s) returned error %v, want %s", tt.op, err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("calculateDecimal(%s) returned error: %s", tt.op, err)
+			}
+			want, _ := operation.Operand{Exact: tt.want}.Decimal()
+			if got, _ := result.Decimal(); got.Cmp(want) != 0 {
+				t.Errorf("calculateDecimal(%s) = %s, want %s", tt.op, result.Exact[:min(len(result.Exact), 20)], tt.want)
+			}
+		})
+	}
+}
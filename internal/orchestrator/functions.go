@@ -0,0 +1,156 @@
+package orchestrator
+
+import (
+	"fmt"
+	"math"
+	"math-calc/internal/operation"
+)
+
+var functionImpls = map[operation.Operator]func(args []float64) (float64, error){
+	"sqrt": unary(func(x float64) (float64, error) {
+		if x < 0 {
+			return 0, fmt.Errorf("square root of negative number %g", x)
+		}
+		return math.Sqrt(x), nil
+	}),
+	"abs":  plain(math.Abs),
+	"exp":  plain(math.Exp),
+	"ln":   logarithm(math.Log),
+	"log":  logarithm(math.Log10),
+	"log2": logarithm(math.Log2),
+	"sin":  plain(math.Sin),
+	"cos":  plain(math.Cos),
+	"tan":  plain(math.Tan),
+	"asin": unary(func(x float64) (float64, error) {
+		if x < -1 || x > 1 {
+			return 0, fmt.Errorf("arcsine of %g is undefined, argument must be in [-1, 1]", x)
+		}
+		return math.Asin(x), nil
+	}),
+	"acos": unary(func(x float64) (float64, error) {
+		if x < -1 || x > 1 {
+			return 0, fmt.Errorf("arccosine of %g is undefined, argument must be in [-1, 1]", x)
+		}
+		return math.Acos(x), nil
+	}),
+	"atan":  plain(math.Atan),
+	"floor": plain(math.Floor),
+	"ceil":  plain(math.Ceil),
+	"round": plain(math.Round),
+	// Real numbers are complex numbers with zero imaginary part
+	"re": plain(func(x float64) float64 {
+		return x
+	}),
+	"im": plain(func(x float64) float64 {
+		return 0
+	}),
+	"conj": plain(func(x float64) float64 {
+		return x
+	}),
+	"arg": plain(func(x float64) float64 {
+		return math.Atan2(0, x)
+	}),
+	"atan2": func(args []float64) (float64, error) {
+		return math.Atan2(args[0], args[1]), nil
+	},
+	"min": func(args []float64) (float64, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Min(result, arg)
+		}
+		return result, nil
+	},
+	"max": func(args []float64) (float64, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			result = math.Max(result, arg)
+		}
+		return result, nil
+	},
+	"sum": func(args []float64) (float64, error) {
+		result := 0.0
+		for _, arg := range args {
+			result += arg
+		}
+		return result, nil
+	},
+	"avg": func(args []float64) (float64, error) {
+		result := 0.0
+		for _, arg := range args {
+			result += arg
+		}
+		return result / float64(len(args)), nil
+	},
+	"factorial": unary(func(x float64) (float64, error) {
+		if x < 0 || x != math.Trunc(x) {
+			return 0, fmt.Errorf("factorial of %g is undefined, argument must be a non-negative integer", x)
+		}
+		return math.Gamma(x + 1), nil
+	}),
+	"gcd": func(args []float64) (float64, error) {
+		result := 0.0
+		for _, arg := range args {
+			if arg != math.Trunc(arg) {
+				return 0, fmt.Errorf("argument %g is not an integer", arg)
+			}
+			result = floatGcd(result, math.Abs(arg))
+		}
+		return result, nil
+	},
+	"lcm": func(args []float64) (float64, error) {
+		result := 1.0
+		for _, arg := range args {
+			if arg != math.Trunc(arg) {
+				return 0, fmt.Errorf("argument %g is not an integer", arg)
+			}
+			if arg == 0 {
+				return 0, nil
+			}
+			result = result / floatGcd(result, math.Abs(arg)) * math.Abs(arg)
+		}
+		return result, nil
+	},
+}
+
+// floatGcd returns the greatest common divisor of non-negative integers a and b.
+func floatGcd(a, b float64) float64 {
+	for b != 0 {
+		a, b = b, math.Mod(a, b)
+	}
+	return a
+}
+
+func unary(f func(float64) (float64, error)) func([]float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		return f(args[0])
+	}
+}
+
+func plain(f func(float64) float64) func([]float64) (float64, error) {
+	return func(args []float64) (float64, error) {
+		return f(args[0]), nil
+	}
+}
+
+func logarithm(f func(float64) float64) func([]float64) (float64, error) {
+	return unary(func(x float64) (float64, error) {
+		if x <= 0 {
+			return 0, fmt.Errorf("logarithm of non-positive number %g", x)
+		}
+		return f(x), nil
+	})
+}
+
+// callFunction calculates a built-in function. The number of arguments is checked by the caller.
+func callFunction(fn operation.Function, args []float64) (float64, error) {
+	f, ok := functionImpls[fn.Name]
+	if !ok {
+		return 0, fmt.Errorf("function %s is not implemented", fn.Name)
+	}
+
+	result, err := f(args)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", fn.Name, err)
+	}
+	return result, nil
+}
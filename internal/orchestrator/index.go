@@ -0,0 +1,51 @@
+package orchestrator
+
+import (
+	"math-calc/internal/operation"
+)
+
+// dependencyIndex maps operations to the operations waiting for their results,
+// so that finishing an operation doesn't require scanning the whole database.
+// It is only used by the main cycle of Run, so it needs no locking.
+type dependencyIndex struct {
+	dependents map[operation.ID]map[operation.ID]struct{}
+}
+
+func newDependencyIndex() *dependencyIndex {
+	return &dependencyIndex{
+		dependents: make(map[operation.ID]map[operation.ID]struct{}),
+	}
+}
+
+// add records that op waits for the operations its operands refer to.
+func (x *dependencyIndex) add(op operation.Operation) {
+	for _, operand := range op.Operands {
+		if operand.OperationID == 0 {
+			continue
+		}
+		set, ok := x.dependents[operand.OperationID]
+		if !ok {
+			set = make(map[operation.ID]struct{})
+			x.dependents[operand.OperationID] = set
+		}
+		set[op.Id] = struct{}{}
+	}
+}
+
+// take returns the operations waiting for id and forgets them, as id is finished.
+// Some of them may not depend on id anymore, e.g. conditionals whose other branch was chosen.
+func (x *dependencyIndex) take(id operation.ID) []operation.ID {
+	set := x.dependents[id]
+	delete(x.dependents, id)
+
+	ids := make([]operation.ID, 0, len(set))
+	for dependent := range set {
+		ids = append(ids, dependent)
+	}
+	return ids
+}
+
+// forget drops the entry of an operation that will never finish, e.g. a skipped branch.
+func (x *dependencyIndex) forget(id operation.ID) {
+	delete(x.dependents, id)
+}
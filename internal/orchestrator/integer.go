@@ -0,0 +1,210 @@
+package orchestrator
+
+import (
+	"fmt"
+	"math-calc/internal/decimal"
+	"math-calc/internal/operation"
+	"math/big"
+)
+
+const (
+	// maxIntegerBits limits the size of results in integer mode, so a single operation can't exhaust memory.
+	maxIntegerBits = 1 << 22
+	// maxFactorial is the largest argument of factorial in integer mode.
+	maxFactorial = 100000
+)
+
+// integerContext holds the rounding mode of integer division. Empty rounding means that
+// inexact division is an error.
+type integerContext struct {
+	rounding decimal.RoundingMode
+}
+
+// quo divides x by y. The divisor must not be zero.
+func (c integerContext) quo(x, y *big.Int) (*big.Int, error) {
+	if c.rounding == "" {
+		q, r := new(big.Int).QuoRem(x, y, new(big.Int))
+		if r.Sign() != 0 {
+			return nil, fmt.Errorf("%s is not divisible by %s, specify rounding to round the quotient", x, y)
+		}
+		return q, nil
+	}
+	return decimal.QuoInt(x, y, c.rounding), nil
+}
+
+var integerFunctions = map[operation.Operator]func(c integerContext, args []*big.Int) (*big.Int, error){
+	"abs": func(c integerContext, args []*big.Int) (*big.Int, error) {
+		return new(big.Int).Abs(args[0]), nil
+	},
+	"floor": integerIdentity,
+	"ceil":  integerIdentity,
+	"round": integerIdentity,
+	"re":    integerIdentity,
+	"conj":  integerIdentity,
+	"im": func(c integerContext, args []*big.Int) (*big.Int, error) {
+		return new(big.Int), nil
+	},
+	"min": func(c integerContext, args []*big.Int) (*big.Int, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(result) < 0 {
+				result = arg
+			}
+		}
+		return new(big.Int).Set(result), nil
+	},
+	"max": func(c integerContext, args []*big.Int) (*big.Int, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(result) > 0 {
+				result = arg
+			}
+		}
+		return new(big.Int).Set(result), nil
+	},
+	"sum": func(c integerContext, args []*big.Int) (*big.Int, error) {
+		return intSum(args), nil
+	},
+	"avg": func(c integerContext, args []*big.Int) (*big.Int, error) {
+		return c.quo(intSum(args), big.NewInt(int64(len(args))))
+	},
+	"factorial": func(c integerContext, args []*big.Int) (*big.Int, error) {
+		n := args[0]
+		if n.Sign() < 0 {
+			return nil, fmt.Errorf("factorial of negative number %s is undefined", n)
+		}
+		if !n.IsInt64() || n.Int64() > maxFactorial {
+			return nil, fmt.Errorf("argument %s is too large, the limit is %d", n, maxFactorial)
+		}
+		return new(big.Int).MulRange(1, n.Int64()), nil
+	},
+	"gcd": func(c integerContext, args []*big.Int) (*big.Int, error) {
+		result := new(big.Int)
+		for _, arg := range args {
+			result.GCD(nil, nil, result, new(big.Int).Abs(arg))
+		}
+		return result, nil
+	},
+	"lcm": func(c integerContext, args []*big.Int) (*big.Int, error) {
+		result := big.NewInt(1)
+		for _, arg := range args {
+			if arg.Sign() == 0 {
+				return new(big.Int), nil
+			}
+			abs := new(big.Int).Abs(arg)
+			gcd := new(big.Int).GCD(nil, nil, result, abs)
+			result.Mul(result.Quo(result, gcd), abs)
+			if result.BitLen() > maxIntegerBits {
+				return nil, fmt.Errorf("result is too large")
+			}
+		}
+		return result, nil
+	},
+}
+
+func integerIdentity(c integerContext, args []*big.Int) (*big.Int, error) {
+	return new(big.Int).Set(args[0]), nil
+}
+
+func calculateInteger(op operation.Operation) (operation.Operand, error) {
+	c := integerContext{rounding: op.Rounding}
+
+	args := make([]*big.Int, len(op.Operands))
+	for i, operand := range op.Operands {
+		var err error
+		args[i], err = operand.Int()
+		if err != nil {
+			return operation.Operand{}, err
+		}
+	}
+
+	result, err := applyInteger(c, op.Op, args)
+	if err != nil {
+		return operation.Operand{}, err
+	}
+	return operation.IntOperand(result), nil
+}
+
+func applyInteger(c integerContext, op operation.Operator, args []*big.Int) (*big.Int, error) {
+	if fn, ok := operation.LookupFunction(string(op)); ok {
+		f, ok := integerFunctions[fn.Name]
+		if !ok {
+			return nil, fmt.Errorf("function %s is not supported in integer mode", fn.Name)
+		}
+		result, err := f(c, args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name, err)
+		}
+		return result, nil
+	}
+
+	if op == operation.Negation {
+		return new(big.Int).Neg(args[0]), nil
+	}
+	left, right := args[0], args[1]
+
+	switch op {
+	case operation.Addition:
+		return new(big.Int).Add(left, right), nil
+	case operation.Subtraction:
+		return new(big.Int).Sub(left, right), nil
+	case operation.Multiply:
+		if left.BitLen()+right.BitLen() > maxIntegerBits {
+			return nil, fmt.Errorf("result is too large")
+		}
+		return new(big.Int).Mul(left, right), nil
+	case operation.Division:
+		if right.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return c.quo(left, right)
+	case operation.FloorDivision:
+		if right.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return decimal.QuoInt(left, right, decimal.Floor), nil
+	case operation.Modulo:
+		if right.Sign() == 0 {
+			return nil, fmt.Errorf("modulo by zero")
+		}
+		quotient := decimal.QuoInt(left, right, decimal.Floor)
+		return new(big.Int).Sub(left, quotient.Mul(quotient, right)), nil
+	case operation.Power:
+		return intPow(c, left, right)
+	}
+	return nil, fmt.Errorf("unknown operation %s", op)
+}
+
+func intPow(c integerContext, base, exponent *big.Int) (*big.Int, error) {
+	if base.Sign() == 0 && exponent.Sign() < 0 {
+		return nil, fmt.Errorf("zero raised to a negative power")
+	}
+	// Powers of 0, 1 and -1 never grow, whatever the exponent is
+	if base.CmpAbs(big.NewInt(1)) <= 0 {
+		if base.Sign() < 0 && exponent.Bit(0) == 1 {
+			return big.NewInt(-1), nil
+		}
+		if base.Sign() == 0 && exponent.Sign() != 0 {
+			return new(big.Int), nil
+		}
+		return big.NewInt(1), nil
+	}
+
+	n := new(big.Int).Abs(exponent)
+	if !n.IsInt64() || n.Int64() > maxIntegerBits/int64(base.BitLen()-1) {
+		return nil, fmt.Errorf("result of %s^%s is too large", base, exponent)
+	}
+	result := new(big.Int).Exp(base, n, nil)
+	if exponent.Sign() < 0 {
+		return c.quo(big.NewInt(1), result)
+	}
+	return result, nil
+}
+
+func intSum(args []*big.Int) *big.Int {
+	sum := new(big.Int)
+	for _, arg := range args {
+		sum.Add(sum, arg)
+	}
+	return sum
+}
@@ -0,0 +1,79 @@
+package orchestrator
+
+import (
+	"fmt"
+	"math-calc/internal/operation"
+)
+
+var comparisons = map[operation.Operator]func(c int) bool{
+	operation.Less:         func(c int) bool { return c < 0 },
+	operation.LessEqual:    func(c int) bool { return c <= 0 },
+	operation.Greater:      func(c int) bool { return c > 0 },
+	operation.GreaterEqual: func(c int) bool { return c >= 0 },
+}
+
+// isLogical reports whether op is a comparison, a logical operator or a conditional.
+// They are calculated the same way in all modes.
+func isLogical(op operation.Operator) bool {
+	switch op {
+	case operation.Equal, operation.NotEqual, operation.And, operation.Or, operation.Not, operation.Conditional:
+		return true
+	}
+	_, ok := comparisons[op]
+	return ok
+}
+
+func calculateLogical(op operation.Operation) (operation.Operand, error) {
+	if op.Op == operation.Conditional {
+		// Normally the orchestrator resolves conditionals without workers
+		cond, err := operation.Truth(op.Mode, op.Operands[0])
+		if err != nil {
+			return operation.Operand{}, err
+		}
+		if cond {
+			return op.Operands[1], nil
+		}
+		return op.Operands[2], nil
+	}
+
+	result, err := applyLogical(op.Mode, op.Op, op.Operands)
+	if err != nil {
+		return operation.Operand{}, err
+	}
+	return operation.Bool(op.Mode, result), nil
+}
+
+func applyLogical(mode operation.Mode, op operation.Operator, args []operation.Operand) (bool, error) {
+	switch op {
+	case operation.Equal:
+		return operation.Equals(mode, args[0], args[1])
+	case operation.NotEqual:
+		equal, err := operation.Equals(mode, args[0], args[1])
+		return !equal, err
+	case operation.Not:
+		truth, err := operation.Truth(mode, args[0])
+		return !truth, err
+	case operation.And, operation.Or:
+		left, err := operation.Truth(mode, args[0])
+		if err != nil {
+			return false, err
+		}
+		right, err := operation.Truth(mode, args[1])
+		if err != nil {
+			return false, err
+		}
+		if op == operation.And {
+			return left && right, nil
+		}
+		return left || right, nil
+	}
+
+	if holds, ok := comparisons[op]; ok {
+		c, err := operation.Compare(mode, args[0], args[1])
+		if err != nil {
+			return false, err
+		}
+		return holds(c), nil
+	}
+	return false, fmt.Errorf("unknown operation %s", op)
+}
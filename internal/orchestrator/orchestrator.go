@@ -4,17 +4,90 @@ import (
 	"fmt"
 	"math-calc/internal/application"
 	"math-calc/internal/operation"
+	"sync"
 	"time"
 )
 
 type Orchestrator struct {
-	app *application.Application
+	app   *application.Application
+	cache *resultCache
+	index *dependencyIndex
+	// in is the input channel of the main cycle, also the output channel of workers.
+	in chan operation.ID
+	// queue holds pending operations until a worker is free.
+	queue *Queue
+	// searchInterval is the time between checks of the database for operations nobody has submitted.
+	searchInterval time.Duration
+
+	weightsMx sync.Mutex
+	// weights caches weights of users by their ids, see Weight.
+	weights map[int]int
 }
 
+// defaultSearchInterval is used if config.Config.SearchInterval is not set.
+const defaultSearchInterval = 5 * time.Second
+
 func New(app *application.Application) *Orchestrator {
-	return &Orchestrator{
-		app: app,
+	searchInterval := time.Duration(app.Config.SearchInterval) * time.Second
+	if searchInterval <= 0 {
+		searchInterval = defaultSearchInterval
+	}
+	o := &Orchestrator{
+		app:            app,
+		cache:          newResultCache(app.Config.CacheSize, time.Duration(app.Config.CacheTTL)*time.Second),
+		index:          newDependencyIndex(),
+		in:             make(chan operation.ID),
+		searchInterval: searchInterval,
+		weights:        make(map[int]int),
+	}
+	o.queue = NewQueue(o.Weight, o.concurrency)
+	return o
+}
+
+// concurrency returns the number of operations of the user workers may calculate at the same time, 0 for any.
+func (o *Orchestrator) concurrency(owner int) int {
+	limits, err := o.app.Database.GetLimits(owner, o.app.Config.Limits)
+	if err != nil {
+		return o.app.Config.Limits.ConcurrentOperations
 	}
+	return limits.ConcurrentOperations
+}
+
+// Weight returns the share of workers of the user relative to other users, see config.Config.UserWeights.
+func (o *Orchestrator) Weight(owner int) int {
+	o.weightsMx.Lock()
+	defer o.weightsMx.Unlock()
+
+	if weight, ok := o.weights[owner]; ok {
+		return weight
+	}
+	weight := 1
+	user, err := o.app.Database.GetUserByID(owner)
+	if err == nil && o.app.Config.UserWeights[user.Username] > 0 {
+		weight = o.app.Config.UserWeights[user.Username]
+	}
+	o.weights[owner] = weight
+	return weight
+}
+
+// QueueDepths returns the numbers of pending operations waiting for a worker by their owners.
+func (o *Orchestrator) QueueDepths() map[int]int {
+	return o.queue.Depths()
+}
+
+// Submit notifies the orchestrator about new operations in StateCreated,
+// so that they are scheduled immediately instead of on the next check of SearchOperations.
+// It doesn't block, so it can be called before Run and while the database is locked.
+func (o *Orchestrator) Submit(ids ...operation.ID) {
+	for _, id := range ids {
+		go send(o.in, id)
+	}
+}
+
+// CacheStats returns the number of operations completed from the result cache
+// and the number of operations that had to be calculated by workers.
+func (o *Orchestrator) CacheStats() (hits, misses uint64) {
+	return o.cache.stats()
 }
 
 // send with `go` statement is used to avoid deadlock
@@ -25,26 +98,13 @@ func send[T any](ch chan<- T, v T) {
 func (o *Orchestrator) Run() {
 	// Starting workers
 
-	workerIn := make(chan operation.ID) // Workers input channel
-	orchIn := make(chan operation.ID)   // Orchestrator input channel, also workers output channel
-	defer close(workerIn)
-	defer close(orchIn)
+	orchIn := o.in // Orchestrator input channel, also workers output channel
+	defer o.queue.Close()
 
-	allOps, _ := o.app.Database.All()
-	for _, op := range allOps {
-		if op.State == operation.StateProcessing {
-			fmt.Printf("Operation %d is in processing state, setting it to pending\n", op.Id)
-			op.State = operation.StatePending
-			o.app.Database.Update(op)
-		}
-		if op.State == operation.StatePending {
-			fmt.Printf("Operation %d is in pending state, sending it to orchestrator\n", op.Id)
-			go send(orchIn, op.Id)
-		}
-	}
+	o.restore()
 
 	for i := 0; i < o.app.Config.GoroutineCount; i++ {
-		go RunWorker(o.app, workerIn, orchIn)
+		go RunWorker(o.app, o.queue, orchIn)
 	}
 
 	go o.SearchOperations(orchIn)
@@ -52,82 +112,329 @@ func (o *Orchestrator) Run() {
 	// Main cycle
 	for id := range orchIn {
 		o.app.Database.UpdatingMutex.Lock()
+		o.handle(id)
+		o.app.Database.UpdatingMutex.Unlock()
+	}
+}
+
+// restore picks up operations left unfinished by the previous run.
+func (o *Orchestrator) restore() {
+	processing, _ := o.app.Database.ByState(operation.StateProcessing)
+	for _, op := range processing {
+		fmt.Printf("Operation %d is in processing state, setting it to pending\n", op.Id)
+		op.State = operation.StatePending
+		o.app.Database.Update(op)
+	}
+	pending, _ := o.app.Database.ByState(operation.StatePending)
+	for _, op := range pending {
+		fmt.Printf("Operation %d is in pending state, sending it to orchestrator\n", op.Id)
+		go send(o.in, op.Id)
+	}
 
-		op, _ := o.app.Database.Get(id)
-		// Depending on the operation state, dealing with it
-		switch op.State {
-		case operation.StateCreated: // Sent from SearchOperations()
-			fallthrough
-		case operation.StateScheduled: // Sent from Run()
-			if op.LeftOperationID != 0 || op.RightOperationID != 0 {
-				op.State = operation.StateScheduled
-				o.app.Database.Update(op)
-				break
+	// The index isn't stored, operations waiting for dependencies are indexed again.
+	// Dependencies may have finished before their results were substituted, they are handled once more.
+	scheduled, _ := o.app.Database.ByState(operation.StateScheduled)
+	finished := make(map[operation.ID]bool)
+	for _, op := range scheduled {
+		o.index.add(op)
+		for _, operand := range op.Operands {
+			if operand.OperationID == 0 || finished[operand.OperationID] {
+				continue
 			}
+			dep, err := o.app.Database.Get(operand.OperationID)
+			if err == nil && (dep.State == operation.StateDone || dep.State == operation.StateError) {
+				finished[dep.Id] = true
+			}
+		}
+	}
+
+	o.app.Database.UpdatingMutex.Lock()
+	defer o.app.Database.UpdatingMutex.Unlock()
+	for id := range finished {
+		o.handle(id)
+	}
+}
+
+// handle moves the operation with the given id forward according to its state.
+// Operations which have to be handled next are sent to the input channel. The database has to be locked.
+func (o *Orchestrator) handle(id operation.ID) {
+	orchIn := o.in
+	op, _ := o.app.Database.Get(id)
+	// Depending on the operation state, dealing with it
+	switch op.State {
+	case operation.StateCreated: // Sent from Submit() and SearchOperations()
+		fallthrough
+	case operation.StateScheduled: // Sent from Run()
+		// Conditionals are resolved here, they never reach workers
+		if op.Op == operation.Conditional {
+			o.resolveConditional(&op, orchIn)
+			o.app.Database.Update(op)
+			if op.State == operation.StateScheduled {
+				o.index.add(op)
+			}
+			if op.State == operation.StateDone || op.State == operation.StateError {
+				go send(orchIn, op.Id)
+			}
+			break
+		}
+
+		// Dependencies may have finished before this operation was scheduled
+		o.substituteFinished(&op)
+		if op.State == operation.StateError {
+			o.app.Database.Update(op)
+			go send(orchIn, op.Id)
+			break
+		}
+
+		if op.HasDependencies() {
+			op.State = operation.StateScheduled
+			o.app.Database.Update(op)
+			o.index.add(op)
+			break
+		}
 
-			op.State = operation.StatePending
+		// An operation with the same inputs may have been calculated already
+		if result, ok := o.cache.get(op.Key()); ok {
+			op.State = operation.StateDone
+			op.Result = result.Value
+			op.ResultExact = result.Exact
+			op.FinishedTime = time.Now()
 			o.app.Database.Update(op)
-			fallthrough
-		case operation.StatePending:
-			go send(workerIn, id)
-			// State will be updated in RunWorker()
-		case operation.StateProcessing:
+			hits, misses := o.cache.stats()
+			o.app.Logger.Printf("orchestrator: operation%d: result is taken from cache (%d hits, %d misses)\n", op.Id, hits, misses)
+			go send(orchIn, op.Id)
 			break
-		case operation.StateDone: // Sent from RunWorker() and from itself
-			allOps, _ := o.app.Database.All()
-			for _, other := range allOps {
-				if other.State != operation.StateScheduled {
-					continue
-				}
-
-				if other.LeftOperationID == id {
-					other.Left = op.Result
-					other.LeftOperationID = 0
-					o.app.Database.Update(other)
-					go send(orchIn, other.Id)
-				}
-				if other.RightOperationID == id {
-					other.Right = op.Result
-					other.RightOperationID = 0
-					o.app.Database.Update(other)
-					go send(orchIn, other.Id)
-				}
+		}
+
+		op.State = operation.StatePending
+		o.app.Database.Update(op)
+		fallthrough
+	case operation.StatePending:
+		o.queue.Push(op)
+		// State will be updated in RunWorker()
+	case operation.StateProcessing:
+		break
+	case operation.StateDone: // Sent from RunWorker() and from itself
+		if op.Op != operation.Conditional {
+			o.cache.put(op.Key(), op.ResultOperand())
+		}
+
+		for _, dependent := range o.dependents(id) {
+			other, err := o.app.Database.Get(dependent)
+			if err != nil || other.State != operation.StateScheduled {
+				continue
 			}
-		case operation.StateError: // Sent from RunWorker() and Run()
-			allOps, _ := o.app.Database.All()
-			for _, other := range allOps {
-				if other.LeftOperationID == id || other.RightOperationID == id {
-					other.Error = fmt.Sprintf("sub-operation %d failed: %s", op.Id, op.Error)
-					other.State = operation.StateError
-					other.LeftOperationID = 0
-					other.RightOperationID = 0
-					o.app.Database.Update(other)
-					go send(orchIn, other.Id)
-				}
+
+			if !other.DependsOn(id) {
+				continue
 			}
+
+			result, err := other.Convert(op.Mode, op.ResultOperand())
+			if err != nil {
+				o.fail(&other, fmt.Sprintf("sub-operation %d: %s", op.Id, err))
+			} else {
+				// The result may be used in several operand slots
+				other.Substitute(id, result)
+			}
+			o.app.Database.Update(other)
+			go send(orchIn, other.Id)
 		}
+	case operation.StateError: // Sent from RunWorker() and Run()
+		for _, dependent := range o.dependents(id) {
+			other, err := o.app.Database.Get(dependent)
+			if err != nil || !other.DependsOn(id) {
+				continue
+			}
+			// Deferred operations find out about the failure if their branch is chosen
+			if other.State == operation.StateDeferred || other.State == operation.StateSkipped {
+				continue
+			}
+			// A failed branch doesn't matter until the condition chooses it
+			cond := other.Operands[0].OperationID
+			if other.Op == operation.Conditional && cond != 0 && cond != id {
+				continue
+			}
 
-		o.app.Database.UpdatingMutex.Unlock()
+			o.fail(&other, fmt.Sprintf("sub-operation %d failed: %s", op.Id, op.Error))
+			o.app.Database.Update(other)
+			go send(orchIn, other.Id)
+		}
+	}
+
+}
+
+// dependents returns the operations which may wait for the finished operation with the given id.
+// The index is only a cache of the database, so operations missing from it are looked up there.
+func (o *Orchestrator) dependents(id operation.ID) []operation.ID {
+	if ids := o.index.take(id); len(ids) > 0 {
+		return ids
+	}
+	ids, err := o.app.Database.Dependents(id)
+	if err != nil {
+		o.app.Logger.Printf("orchestrator: failed to get dependents of operation %d: %s\n", id, err)
+	}
+	return ids
+}
+
+// substituteFinished replaces operands which refer to finished operations with their results.
+// If one of them has failed, op is marked as failed.
+func (o *Orchestrator) substituteFinished(op *operation.Operation) {
+	for i := range op.Operands {
+		o.substituteOperand(op, i)
+		if op.State == operation.StateError {
+			return
+		}
+	}
+}
+
+// substituteOperand replaces the i-th operand with the result of the operation it refers to, if that one is done.
+// If it has failed, op is marked as failed. It reports whether the operand is a literal now.
+func (o *Orchestrator) substituteOperand(op *operation.Operation, i int) bool {
+	id := op.Operands[i].OperationID
+	if id == 0 {
+		return true
+	}
+
+	dep, err := o.app.Database.Get(id)
+	if err != nil {
+		return false
+	}
+	switch dep.State {
+	case operation.StateDone:
+		// Results of other expressions, e.g. bound to saved variables, may be calculated in another mode
+		result, err := op.Convert(dep.Mode, dep.ResultOperand())
+		if err != nil {
+			o.fail(op, fmt.Sprintf("sub-operation %d: %s", dep.Id, err))
+			return false
+		}
+		op.Substitute(dep.Id, result)
+		return true
+	case operation.StateError:
+		o.fail(op, fmt.Sprintf("sub-operation %d failed: %s", dep.Id, dep.Error))
+	}
+	return false
+}
+
+// fail marks op as failed. Branches of a failed conditional are skipped.
+func (o *Orchestrator) fail(op *operation.Operation, reason string) {
+	if op.Op == operation.Conditional {
+		for _, operand := range op.Operands[1:] {
+			o.skip(operand.OperationID)
+		}
+	}
+
+	op.Error = reason
+	op.State = operation.StateError
+	for i := range op.Operands {
+		op.Operands[i] = op.Operands[i].Detach()
+	}
+}
+
+// resolveConditional chooses the branch of a conditional once its condition is known.
+// The chosen branch is activated and the other one is skipped.
+// When the chosen branch is done, its result becomes the result of op.
+func (o *Orchestrator) resolveConditional(op *operation.Operation, out chan<- operation.ID) {
+	if !o.substituteOperand(op, 0) {
+		if op.State != operation.StateError {
+			op.State = operation.StateScheduled
+		}
+		return
+	}
+
+	cond, err := operation.Truth(op.Mode, op.Operands[0])
+	if err != nil {
+		o.fail(op, fmt.Sprintf("condition: %s", err))
+		return
+	}
+
+	chosen, other := 1, 2
+	if !cond {
+		chosen, other = 2, 1
+	}
+	o.skip(op.Operands[other].OperationID)
+	// The other branch is never calculated, so op doesn't depend on it anymore
+	op.Operands[other] = op.Operands[other].Detach()
+
+	o.activate(op.Operands[chosen].OperationID, out)
+	if !o.substituteOperand(op, chosen) {
+		if op.State != operation.StateError {
+			op.State = operation.StateScheduled
+		}
+		return
+	}
+
+	result := op.Operands[chosen]
+	op.State = operation.StateDone
+	op.Result = result.Value
+	op.ResultExact = result.Exact
+	op.FinishedTime = time.Now()
+}
+
+// activate moves a deferred operation and its deferred dependencies to StateCreated.
+// Branches of nested conditionals stay deferred until their own conditions are known.
+func (o *Orchestrator) activate(id operation.ID, out chan<- operation.ID) {
+	if id == 0 {
+		return
+	}
+	op, err := o.app.Database.Get(id)
+	if err != nil || op.State != operation.StateDeferred {
+		return
+	}
+
+	op.State = operation.StateCreated
+	o.app.Database.Update(op)
+	go send(out, op.Id)
+
+	deps := op.Operands
+	if op.Op == operation.Conditional {
+		deps = deps[:1]
+	}
+	for _, dep := range deps {
+		o.activate(dep.OperationID, out)
+	}
+}
+
+// skip marks a deferred operation and its deferred dependencies as skipped.
+func (o *Orchestrator) skip(id operation.ID) {
+	if id == 0 {
+		return
+	}
+	op, err := o.app.Database.Get(id)
+	if err != nil || op.State != operation.StateDeferred {
+		return
+	}
+
+	op.State = operation.StateSkipped
+	op.FinishedTime = time.Now()
+	o.app.Database.Update(op)
+	o.index.forget(op.Id)
+
+	for _, dep := range op.Operands {
+		o.skip(dep.OperationID)
 	}
 }
 
 // SearchOperations periodically checks the database for operations of following states:
 // - StateCreated
+// New operations are submitted by the server, so this only picks up the ones left after a restart
+// or created by other means.
 func (o *Orchestrator) SearchOperations(out chan<- operation.ID) {
 	for {
-		<-time.After(5 * time.Second)
+		<-time.After(o.searchInterval)
 
-		ops, err := o.app.Database.All()
+		ops, err := o.app.Database.ByState(operation.StateCreated)
 		if err != nil {
 			o.app.Logger.Printf("SearchOperations: failed to get operations: %s\n", err)
 			continue
 		}
 
 		for id, op := range ops {
-			if op.State == operation.StateCreated {
-				o.app.Logger.Printf("SearchOperations: sent new operation %d to orchestrator\n", id)
-				out <- id
+			// Recent operations are being scheduled by Submit
+			if time.Since(op.CreatedTime) < o.searchInterval {
+				continue
 			}
+			o.app.Logger.Printf("SearchOperations: sent new operation %d to orchestrator\n", id)
+			out <- id
 		}
 	}
 }
@@ -0,0 +1,119 @@
+package orchestrator
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"math-calc/internal/application"
+	"math-calc/internal/db"
+	"math-calc/internal/operation"
+	"path/filepath"
+	"testing"
+)
+
+func newTestOrchestrator(tb testing.TB) *Orchestrator {
+	tb.Helper()
+	database, err := db.NewSqlite(filepath.Join(tb.TempDir(), "db.sqlite3"))
+	if err != nil {
+		tb.Fatalf("failed to open database: %s", err)
+	}
+	tb.Cleanup(func() { database.Close() })
+
+	app := &application.Application{Logger: log.New(io.Discard, "", 0), Database: database}
+	o := New(app)
+	// Operations sent to the main cycle are not handled by tests
+	go func() {
+		for range o.in {
+		}
+	}()
+	return o
+}
+
+// createOperation stores an addition of the operands in the given state.
+func createOperation(tb testing.TB, o *Orchestrator, state operation.State, operands ...operation.Operand) operation.Operation {
+	tb.Helper()
+	op := operation.Operation{OwnerID: 1, Op: operation.Addition, Mode: operation.ModeFloat, Operands: operands}
+	id, err := o.app.Database.Create(op)
+	if err != nil {
+		tb.Fatalf("failed to create operation: %s", err)
+	}
+	op, _ = o.app.Database.Get(id)
+	op.State = state
+	if state == operation.StateDone {
+		op.Result = 3
+	}
+	o.app.Database.Update(op)
+	return op
+}
+
+func TestCompletionSubstitutesResult(t *testing.T) {
+	o := newTestOrchestrator(t)
+	dep := createOperation(t, o, operation.StateDone, operation.Operand{Value: 1}, operation.Operand{Value: 2})
+	dependent := createOperation(t, o, operation.StateScheduled, operation.Operand{OperationID: dep.Id}, operation.Operand{OperationID: dep.Id})
+	o.index.add(dependent)
+
+	o.handle(dep.Id)
+
+	got, _ := o.app.Database.Get(dependent.Id)
+	if got.HasDependencies() || got.Operands[0].Value != 3 || got.Operands[1].Value != 3 {
+		t.Errorf("operands of the dependent are %+v, want the result of operation %d in both", got.Operands, dep.Id)
+	}
+	if len(o.index.take(dep.Id)) != 0 {
+		t.Errorf("operation %d is still indexed after completion", dep.Id)
+	}
+}
+
+// TestRestoreSubstitutesResult covers a restart after a dependency was done but before its result was substituted.
+func TestRestoreSubstitutesResult(t *testing.T) {
+	o := newTestOrchestrator(t)
+	dep := createOperation(t, o, operation.StateDone, operation.Operand{Value: 1}, operation.Operand{Value: 2})
+	dependent := createOperation(t, o, operation.StateScheduled, operation.Operand{OperationID: dep.Id}, operation.Operand{Value: 1})
+	other := createOperation(t, o, operation.StateScheduled, operation.Operand{OperationID: dependent.Id}, operation.Operand{Value: 1})
+
+	o.restore()
+
+	got, _ := o.app.Database.Get(dependent.Id)
+	if got.HasDependencies() || got.Operands[0].Value != 3 {
+		t.Errorf("operands of the dependent are %+v, want the result of operation %d", got.Operands, dep.Id)
+	}
+	if ids := o.index.take(dependent.Id); len(ids) != 1 || ids[0] != other.Id {
+		t.Errorf("operations waiting for operation %d are %v, want [%d]", dependent.Id, ids, other.Id)
+	}
+}
+
+func TestCompletionFindsDependentsMissingFromIndex(t *testing.T) {
+	o := newTestOrchestrator(t)
+	dep := createOperation(t, o, operation.StateDone, operation.Operand{Value: 1}, operation.Operand{Value: 2})
+	dependent := createOperation(t, o, operation.StateScheduled, operation.Operand{OperationID: dep.Id}, operation.Operand{Value: 1})
+
+	o.handle(dep.Id)
+
+	got, _ := o.app.Database.Get(dependent.Id)
+	if got.HasDependencies() || got.Operands[0].Value != 3 {
+		t.Errorf("operands of the dependent are %+v, want the result of operation %d", got.Operands, dep.Id)
+	}
+}
+
+// BenchmarkCompletion measures handling of a finished operation with a single dependent.
+// The time doesn't depend on the number of operations in the database, as dependents are found in the index.
+func BenchmarkCompletion(b *testing.B) {
+	for _, history := range []int{100, 10000} {
+		b.Run(fmt.Sprintf("history=%d", history), func(b *testing.B) {
+			o := newTestOrchestrator(b)
+			for i := 0; i < history; i++ {
+				createOperation(b, o, operation.StateDone, operation.Operand{Value: 1}, operation.Operand{Value: 2})
+			}
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				dep := createOperation(b, o, operation.StateDone, operation.Operand{Value: 1}, operation.Operand{Value: 2})
+				dependent := createOperation(b, o, operation.StateScheduled, operation.Operand{OperationID: dep.Id}, operation.Operand{Value: 1})
+				o.index.add(dependent)
+				b.StartTimer()
+
+				o.handle(dep.Id)
+			}
+		})
+	}
+}
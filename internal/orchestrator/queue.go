@@ -0,0 +1,219 @@
+package orchestrator
+
+import (
+	"container/heap"
+	"math-calc/internal/operation"
+	"sync"
+)
+
+// Queue holds pending operations until workers take them.
+// Users share workers according to their weights using deficit round robin: users with pending operations
+// take turns, and in its turn a user gets as many operations calculated as its weight allows,
+// so a user with a huge expression can't starve the others.
+// Users who have as many operations being calculated as they may have at the same time are passed over.
+// Operations of a single user go in order of Priority, then longer CriticalPath, so that the slowest chain
+// of an expression isn't delayed by operations which have time to wait, then older operations first.
+type Queue struct {
+	mx sync.Mutex
+	// ready is signalled when an operation may be taken: one is pushed or a worker has finished.
+	ready *sync.Cond
+	// weight returns the weight of the user, at least 1.
+	weight func(owner int) int
+	// concurrency returns the number of operations of the user which may be calculated at the same time, 0 for any.
+	concurrency func(owner int) int
+	owners      map[int]*ownerQueue
+	// queued are the ids of operations in the queue. Pushing one of them again is ignored.
+	queued map[operation.ID]struct{}
+	// running are the numbers of operations taken by workers and not done yet, by their owners.
+	running map[int]int
+	// active are the users with pending operations in the order of their turns.
+	active []int
+	// turn is the index of the user in active whose operations are taken now.
+	turn int
+	// next numbers pushed operations, so that operations of equal rank keep their order.
+	next   uint64
+	closed bool
+}
+
+// ownerQueue holds pending operations of a single user.
+type ownerQueue struct {
+	items queueItems
+	// deficit is the number of operations the user may still take in its current turn.
+	deficit int
+	// concurrency is the limit of operations of the user calculated at the same time, 0 if there is none.
+	// It is looked up once the user has pending operations.
+	concurrency int
+}
+
+type queueItem struct {
+	id           operation.ID
+	priority     int
+	criticalPath int
+	seq          uint64
+}
+
+// NewQueue returns an empty queue. weight returns the share of workers of a user relative to others,
+// concurrency returns the number of operations of a user which may be calculated at the same time, 0 for any.
+func NewQueue(weight func(owner int) int, concurrency func(owner int) int) *Queue {
+	q := &Queue{
+		weight:      weight,
+		concurrency: concurrency,
+		owners:      make(map[int]*ownerQueue),
+		queued:      make(map[operation.ID]struct{}),
+		running:     make(map[int]int),
+	}
+	q.ready = sync.NewCond(&q.mx)
+	return q
+}
+
+// Push adds a pending operation to the queue. Operations which are already queued are ignored,
+// as the same operation may be scheduled both by Submit and by SearchOperations.
+func (q *Queue) Push(op operation.Operation) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	if _, ok := q.queued[op.Id]; ok {
+		return
+	}
+	q.queued[op.Id] = struct{}{}
+
+	owner, ok := q.owners[op.OwnerID]
+	if !ok {
+		owner = &ownerQueue{concurrency: q.concurrency(op.OwnerID)}
+		q.owners[op.OwnerID] = owner
+		q.active = append(q.active, op.OwnerID)
+		// The only user starts its turn right away, others wait for theirs
+		if len(q.active) == 1 {
+			q.turn = 0
+			owner.deficit = q.weight(op.OwnerID)
+		}
+	}
+
+	heap.Push(&owner.items, queueItem{id: op.Id, priority: op.Priority, criticalPath: op.CriticalPath, seq: q.next})
+	q.next++
+	q.ready.Signal()
+}
+
+// Pop removes the next operation from the queue and returns it with its owner.
+// It waits while there is no operation which may be taken. It returns false once the queue is closed.
+// Done has to be called once the operation is calculated.
+func (q *Queue) Pop() (operation.ID, int, bool) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	for !q.closed && !q.hasReady() {
+		q.ready.Wait()
+	}
+	if q.closed {
+		return 0, 0, false
+	}
+
+	for {
+		id := q.active[q.turn]
+		owner := q.owners[id]
+		if owner.deficit < 1 || q.saturated(id) {
+			// Users can't save their turns while they are waiting for running operations
+			if owner.deficit >= 1 {
+				owner.deficit = 0
+			}
+			q.startTurn((q.turn + 1) % len(q.active))
+			continue
+		}
+
+		owner.deficit--
+		q.running[id]++
+		item := heap.Pop(&owner.items).(queueItem)
+		delete(q.queued, item.id)
+		if len(owner.items) == 0 {
+			// Users without pending operations don't keep their deficit
+			delete(q.owners, id)
+			q.active = append(q.active[:q.turn], q.active[q.turn+1:]...)
+			if len(q.active) > 0 {
+				q.startTurn(q.turn % len(q.active))
+			}
+		}
+		return item.id, id, true
+	}
+}
+
+// Done reports that a worker has finished an operation of the owner taken with Pop.
+func (q *Queue) Done(owner int) {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	q.running[owner]--
+	if q.running[owner] <= 0 {
+		delete(q.running, owner)
+	}
+	q.ready.Signal()
+}
+
+// hasReady reports whether any user with pending operations may have one more calculated now.
+func (q *Queue) hasReady() bool {
+	for _, id := range q.active {
+		if !q.saturated(id) {
+			return true
+		}
+	}
+	return false
+}
+
+// saturated reports whether the active user has as many operations calculated as it may have at the same time.
+func (q *Queue) saturated(owner int) bool {
+	limit := q.owners[owner].concurrency
+	return limit > 0 && q.running[owner] >= limit
+}
+
+// startTurn passes the turn to the i-th active user.
+func (q *Queue) startTurn(i int) {
+	q.turn = i
+	q.owners[q.active[i]].deficit += q.weight(q.active[i])
+}
+
+// Depths returns the numbers of queued operations of users who have any.
+func (q *Queue) Depths() map[int]int {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	depths := make(map[int]int, len(q.owners))
+	for id, owner := range q.owners {
+		depths[id] = len(owner.items)
+	}
+	return depths
+}
+
+// Close stops workers waiting in Pop.
+func (q *Queue) Close() {
+	q.mx.Lock()
+	defer q.mx.Unlock()
+
+	q.closed = true
+	q.ready.Broadcast()
+}
+
+// queueItems implements heap.Interface, the first item is the one to calculate next.
+type queueItems []queueItem
+
+func (items queueItems) Len() int { return len(items) }
+
+func (items queueItems) Less(i, j int) bool {
+	a, b := items[i], items[j]
+	if a.priority != b.priority {
+		return a.priority > b.priority
+	}
+	if a.criticalPath != b.criticalPath {
+		return a.criticalPath > b.criticalPath
+	}
+	return a.seq < b.seq
+}
+
+func (items queueItems) Swap(i, j int) { items[i], items[j] = items[j], items[i] }
+
+func (items *queueItems) Push(x any) { *items = append(*items, x.(queueItem)) }
+
+func (items *queueItems) Pop() any {
+	old := *items
+	item := old[len(old)-1]
+	*items = old[:len(old)-1]
+	return item
+}
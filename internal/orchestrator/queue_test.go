@@ -0,0 +1,191 @@
+package orchestrator
+
+import (
+	"math-calc/internal/operation"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestQueueOrder(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  []operation.Operation
+		want []operation.ID
+	}{
+		{
+			name: "pushing order",
+			ops:  []operation.Operation{{Id: 1}, {Id: 2}, {Id: 3}},
+			want: []operation.ID{1, 2, 3},
+		},
+		{
+			name: "priority first",
+			ops:  []operation.Operation{{Id: 1}, {Id: 2, Priority: 5}, {Id: 3, Priority: -1}, {Id: 4, Priority: 5}},
+			want: []operation.ID{2, 4, 1, 3},
+		},
+		{
+			name: "longer critical path first",
+			ops:  []operation.Operation{{Id: 1, CriticalPath: 1}, {Id: 2, CriticalPath: 3}, {Id: 3}, {Id: 4, CriticalPath: 3}},
+			want: []operation.ID{2, 4, 1, 3},
+		},
+		{
+			name: "priority before critical path",
+			ops:  []operation.Operation{{Id: 1, CriticalPath: 10}, {Id: 2, Priority: 1}, {Id: 3, Priority: 1, CriticalPath: 2}},
+			want: []operation.ID{3, 2, 1},
+		},
+		{
+			name: "duplicate pushes",
+			ops:  []operation.Operation{{Id: 1}, {Id: 2}, {Id: 1, Priority: 1}, {Id: 2}, {Id: 3}},
+			want: []operation.ID{1, 2, 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewQueue(func(int) int { return 1 }, func(int) int { return 0 })
+			for _, op := range tt.ops {
+				q.Push(op)
+			}
+
+			if depths := q.Depths(); depths[0] != len(tt.want) {
+				t.Errorf("Depths() = %v, want map[0:%d]", depths, len(tt.want))
+			}
+
+			var got []operation.ID
+			for range tt.want {
+				id, owner, _ := q.Pop()
+				q.Done(owner)
+				got = append(got, id)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("operations are popped in order %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueueFairness(t *testing.T) {
+	tests := []struct {
+		name    string
+		weights map[int]int
+		// pushed are the numbers of operations pushed by owners 1 and 2, in this order
+		pushed [2]int
+		want   []int
+	}{
+		{
+			name:   "equal weights",
+			pushed: [2]int{6, 3},
+			want:   []int{1, 2, 1, 2, 1, 2, 1, 1, 1},
+		},
+		{
+			name:    "weighted",
+			weights: map[int]int{1: 3},
+			pushed:  [2]int{8, 3},
+			want:    []int{1, 1, 1, 2, 1, 1, 1, 2, 1, 1, 2},
+		},
+		{
+			name:    "weighted user arrives later",
+			weights: map[int]int{2: 2},
+			pushed:  [2]int{4, 4},
+			want:    []int{1, 2, 2, 1, 2, 2, 1, 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			weight := func(owner int) int {
+				if w := tt.weights[owner]; w > 0 {
+					return w
+				}
+				return 1
+			}
+			q := NewQueue(weight, func(int) int { return 0 })
+			id := operation.ID(1)
+			for i, n := range tt.pushed {
+				for j := 0; j < n; j++ {
+					q.Push(operation.Operation{Id: id, OwnerID: i + 1})
+					id++
+				}
+			}
+
+			var got []int
+			for range tt.want {
+				_, owner, _ := q.Pop()
+				q.Done(owner)
+				got = append(got, owner)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("owners of popped operations are %v, want %v", got, tt.want)
+			}
+			if depths := q.Depths(); len(depths) != 0 {
+				t.Errorf("queue still has operations: %v", depths)
+			}
+		})
+	}
+}
+
+func TestQueueConcurrency(t *testing.T) {
+	concurrency := func(owner int) int {
+		if owner == 1 {
+			return 1
+		}
+		return 0
+	}
+	q := NewQueue(func(int) int { return 1 }, concurrency)
+	for i := 1; i <= 6; i++ {
+		q.Push(operation.Operation{Id: operation.ID(i), OwnerID: (i-1)/3 + 1})
+	}
+
+	// Owner 1 may have a single operation calculated, so owner 2 takes the other workers
+	var owners []int
+	for i := 0; i < 4; i++ {
+		_, owner, _ := q.Pop()
+		owners = append(owners, owner)
+	}
+	if want := []int{1, 2, 2, 2}; !reflect.DeepEqual(owners, want) {
+		t.Errorf("owners of popped operations are %v, want %v", owners, want)
+	}
+	if depths := q.Depths(); !reflect.DeepEqual(depths, map[int]int{1: 2}) {
+		t.Errorf("Depths() = %v, want map[1:2]", depths)
+	}
+
+	popped := make(chan int)
+	go func() {
+		_, owner, _ := q.Pop()
+		popped <- owner
+	}()
+	select {
+	case owner := <-popped:
+		t.Fatalf("operation of owner %d is popped while owner 1 is saturated", owner)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	q.Done(1)
+	select {
+	case owner := <-popped:
+		if owner != 1 {
+			t.Errorf("operation of owner %d is popped, want 1", owner)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no operation is popped after owner 1 has finished one")
+	}
+}
+
+func TestQueueClose(t *testing.T) {
+	q := NewQueue(func(int) int { return 1 }, func(int) int { return 0 })
+	done := make(chan bool)
+	go func() {
+		_, _, ok := q.Pop()
+		done <- ok
+	}()
+
+	q.Close()
+	select {
+	case ok := <-done:
+		if ok {
+			t.Error("Pop() returned an operation from an empty closed queue")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Pop() is still waiting after Close()")
+	}
+}
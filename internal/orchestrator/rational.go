@@ -0,0 +1,192 @@
+package orchestrator
+
+import (
+	"fmt"
+	"math-calc/internal/operation"
+	"math/big"
+)
+
+const (
+	// maxRationalExponent limits powers in rational mode, so a single operation can't exhaust memory.
+	maxRationalExponent = 10000
+	// maxRationalBits limits the total size of numerators and denominators of results in rational mode, see ratBits.
+	maxRationalBits = maxIntegerBits
+)
+
+var rationalFunctions = map[operation.Operator]func(args []*big.Rat) (*big.Rat, error){
+	"abs": func(args []*big.Rat) (*big.Rat, error) {
+		return new(big.Rat).Abs(args[0]), nil
+	},
+	"floor": func(args []*big.Rat) (*big.Rat, error) {
+		return new(big.Rat).SetInt(ratFloor(args[0])), nil
+	},
+	"ceil": func(args []*big.Rat) (*big.Rat, error) {
+		return new(big.Rat).SetInt(ratCeil(args[0])), nil
+	},
+	"round": func(args []*big.Rat) (*big.Rat, error) {
+		// Half away from zero, like math.Round
+		half := big.NewRat(1, 2)
+		abs := new(big.Rat).Abs(args[0])
+		rounded := new(big.Rat).SetInt(ratFloor(abs.Add(abs, half)))
+		if args[0].Sign() < 0 {
+			rounded.Neg(rounded)
+		}
+		return rounded, nil
+	},
+	"re": func(args []*big.Rat) (*big.Rat, error) {
+		return new(big.Rat).Set(args[0]), nil
+	},
+	"im": func(args []*big.Rat) (*big.Rat, error) {
+		return new(big.Rat), nil
+	},
+	"conj": func(args []*big.Rat) (*big.Rat, error) {
+		return new(big.Rat).Set(args[0]), nil
+	},
+	"min": func(args []*big.Rat) (*big.Rat, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(result) < 0 {
+				result = arg
+			}
+		}
+		return new(big.Rat).Set(result), nil
+	},
+	"max": func(args []*big.Rat) (*big.Rat, error) {
+		result := args[0]
+		for _, arg := range args[1:] {
+			if arg.Cmp(result) > 0 {
+				result = arg
+			}
+		}
+		return new(big.Rat).Set(result), nil
+	},
+	"sum": func(args []*big.Rat) (*big.Rat, error) {
+		return ratSum(args), nil
+	},
+	"avg": func(args []*big.Rat) (*big.Rat, error) {
+		sum := ratSum(args)
+		return sum.Quo(sum, big.NewRat(int64(len(args)), 1)), nil
+	},
+}
+
+func calculateRational(op operation.Operator, operands []operation.Operand) (operation.Operand, error) {
+	args := make([]*big.Rat, len(operands))
+	for i, operand := range operands {
+		var err error
+		args[i], err = operand.Rat()
+		if err != nil {
+			return operation.Operand{}, err
+		}
+	}
+
+	result, err := applyRational(op, args)
+	if err != nil {
+		return operation.Operand{}, err
+	}
+	if ratBits(result) > maxRationalBits {
+		return operation.Operand{}, fmt.Errorf("result is too large")
+	}
+	return operation.RatOperand(result), nil
+}
+
+func applyRational(op operation.Operator, args []*big.Rat) (*big.Rat, error) {
+	if fn, ok := operation.LookupFunction(string(op)); ok {
+		f, ok := rationalFunctions[fn.Name]
+		if !ok {
+			return nil, fmt.Errorf("function %s is not supported in rational mode", fn.Name)
+		}
+		result, err := f(args)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", fn.Name, err)
+		}
+		return result, nil
+	}
+
+	if op == operation.Negation {
+		return new(big.Rat).Neg(args[0]), nil
+	}
+	left, right := args[0], args[1]
+
+	switch op {
+	case operation.Addition:
+		return new(big.Rat).Add(left, right), nil
+	case operation.Subtraction:
+		return new(big.Rat).Sub(left, right), nil
+	case operation.Multiply:
+		if ratBits(left)+ratBits(right) > maxRationalBits {
+			return nil, fmt.Errorf("result is too large")
+		}
+		return new(big.Rat).Mul(left, right), nil
+	case operation.Division:
+		if right.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		if ratBits(left)+ratBits(right) > maxRationalBits {
+			return nil, fmt.Errorf("result is too large")
+		}
+		return new(big.Rat).Quo(left, right), nil
+	case operation.FloorDivision:
+		if right.Sign() == 0 {
+			return nil, fmt.Errorf("division by zero")
+		}
+		return new(big.Rat).SetInt(ratFloor(new(big.Rat).Quo(left, right))), nil
+	case operation.Modulo:
+		if right.Sign() == 0 {
+			return nil, fmt.Errorf("modulo by zero")
+		}
+		quotient := new(big.Rat).SetInt(ratFloor(new(big.Rat).Quo(left, right)))
+		return new(big.Rat).Sub(left, quotient.Mul(quotient, right)), nil
+	case operation.Power:
+		return ratPow(left, right)
+	}
+	return nil, fmt.Errorf("unknown operation %s", op)
+}
+
+func ratPow(base, exponent *big.Rat) (*big.Rat, error) {
+	if !exponent.IsInt() {
+		return nil, fmt.Errorf("non-integer power %s is not supported in rational mode", exponent.RatString())
+	}
+	if !exponent.Num().IsInt64() || exponent.Num().Int64() > maxRationalExponent || exponent.Num().Int64() < -maxRationalExponent {
+		return nil, fmt.Errorf("exponent %s is too large, the limit is %d", exponent.RatString(), maxRationalExponent)
+	}
+	if base.Sign() == 0 && exponent.Sign() < 0 {
+		return nil, fmt.Errorf("zero raised to a negative power")
+	}
+
+	n := new(big.Int).Abs(exponent.Num())
+	// Powers of 0, 1 and -1 never grow, the size of other ones grows linearly with the exponent
+	if base.Num().CmpAbs(base.Denom()) != 0 && base.Sign() != 0 && n.Int64()*int64(ratBits(base)) > maxRationalBits {
+		return nil, fmt.Errorf("result of raising a %d-bit fraction to the power %s is too large", ratBits(base), exponent.RatString())
+	}
+	num := new(big.Int).Exp(base.Num(), n, nil)
+	den := new(big.Int).Exp(base.Denom(), n, nil)
+	if exponent.Sign() < 0 {
+		num, den = den, num
+	}
+	return new(big.Rat).SetFrac(num, den), nil
+}
+
+// ratFloor returns the largest integer not greater than r.
+func ratFloor(r *big.Rat) *big.Int {
+	// Denominator is always positive, so Euclidean division rounds towards negative infinity
+	return new(big.Int).Div(r.Num(), r.Denom())
+}
+
+// ratCeil returns the smallest integer not less than r.
+func ratCeil(r *big.Rat) *big.Int {
+	floor := ratFloor(new(big.Rat).Neg(r))
+	return floor.Neg(floor)
+}
+
+func ratSum(args []*big.Rat) *big.Rat {
+	sum := new(big.Rat)
+	for _, arg := range args {
+		sum.Add(sum, arg)
+	}
+	return sum
+}
+
+// ratBits returns the size of the fraction: the total bit length of its numerator and denominator.
+func ratBits(r *big.Rat) int {
+	return r.Num().BitLen() + r.Denom().BitLen()
+}
@@ -0,0 +1,36 @@
+package orchestrator
+
+import (
+	"math-calc/internal/operation"
+	"testing"
+)
+
+func TestCalculateRationalLimits(t *testing.T) {
+	large, err := calculateRational(operation.Power, []operation.Operand{{Exact: "10"}, {Exact: "10000"}})
+	if err != nil {
+		t.Fatalf("10^10000 returned error: %s", err)
+	}
+
+	tests := []struct {
+		name     string
+		op       operation.Operator
+		operands []operation.Operand
+	}{
+		{"power of a large number", operation.Power, []operation.Operand{large, {Exact: "10000"}}},
+		{"power of a large fraction", operation.Power, []operation.Operand{{Exact: "1/" + large.Exact}, {Exact: "-10000"}}},
+		{"exponent out of range", operation.Power, []operation.Operand{{Exact: "2"}, {Exact: "100001"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := calculateRational(tt.op, tt.operands); err == nil {
+				t.Errorf("calculateRational(%s) returned no error", tt.op)
+			}
+		})
+	}
+
+	// Powers of 1 and -1 don't grow
+	result, err := calculateRational(operation.Power, []operation.Operand{{Exact: "-1"}, {Exact: "9999"}})
+	if err != nil || result.Exact != "-1" {
+		t.Errorf("(-1)^9999 = %q, %v, want -1", result.Exact, err)
+	}
+}
@@ -2,15 +2,27 @@ package orchestrator
 
 import (
 	"fmt"
+	"math"
 	"math-calc/internal/application"
 	"math-calc/internal/operation"
 	"time"
 )
 
-func RunWorker(app *application.Application, in <-chan operation.ID, out chan<- operation.ID) {
-	for op := range in {
+func RunWorker(app *application.Application, in *Queue, out chan<- operation.ID) {
+	for {
+		id, owner, ok := in.Pop()
+		if !ok {
+			return
+		}
+
 		app.Database.UpdatingMutex.Lock()
-		op, _ := app.Database.Get(op)
+		op, _ := app.Database.Get(id)
+		// The operation may be sent twice if it was both submitted and found by SearchOperations
+		if op.State != operation.StatePending {
+			app.Database.UpdatingMutex.Unlock()
+			in.Done(owner)
+			continue
+		}
 		op.State = operation.StateProcessing
 		app.Database.Update(op)
 		app.Database.UpdatingMutex.Unlock()
@@ -18,7 +30,7 @@ func RunWorker(app *application.Application, in <-chan operation.ID, out chan<-
 		app.Logger.Printf("worker: operation%d: started\n", op.Id)
 
 		duration := time.Duration(app.Config.OperationCalculationTime) * time.Second
-		result, err := Calculate(op.Op, op.Left, op.Right, duration)
+		result, err := Calculate(op, duration)
 		op, _ = app.Database.Get(op.Id)
 
 		app.Database.UpdatingMutex.Lock()
@@ -28,23 +40,100 @@ func RunWorker(app *application.Application, in <-chan operation.ID, out chan<-
 			app.Logger.Printf("worker: operation%d: failed to calculate: %s\n", op.Id, err)
 		} else {
 			op.State = operation.StateDone
-			op.Result = result
-			app.Logger.Printf("worker: operation%d: calculated successfully, result is %f\n", op.Id, result)
+			op.Result = result.Value
+			op.ResultExact = result.Exact
+			app.Logger.Printf("worker: operation%d: calculated successfully, result is %s\n", op.Id, formatOperand(result))
 		}
 
 		op.FinishedTime = time.Now()
 
 		app.Database.Update(op)
 		app.Database.UpdatingMutex.Unlock()
+		in.Done(owner)
 
 		out <- op.Id
 	}
 }
 
-func Calculate(op operation.Operator, left, right float64, duration time.Duration) (float64, error) {
+// Calculate applies the operator of op to its operands in op.Mode. The result is returned as a literal operand.
+func Calculate(op operation.Operation, duration time.Duration) (operation.Operand, error) {
 	// Implement some delay to simulate real work
 	<-time.After(duration)
 
+	err := checkArity(op.Op, len(op.Operands))
+	if err != nil {
+		return operation.Operand{}, err
+	}
+
+	if isArrayOperation(op) {
+		return calculateArray(op)
+	}
+
+	if isLogical(op.Op) {
+		return calculateLogical(op)
+	}
+
+	switch op.Mode {
+	case operation.ModeRational:
+		return calculateRational(op.Op, op.Operands)
+	case operation.ModeDecimal:
+		return calculateDecimal(op)
+	case operation.ModeComplex:
+		return calculateComplex(op.Op, op.Operands)
+	case operation.ModeInteger:
+		return calculateInteger(op)
+	}
+
+	result, err := calculateFloat(op.Op, op.Values())
+	return operation.Operand{Value: result}, err
+}
+
+// checkArity returns an error if op can't be applied to n operands.
+func checkArity(op operation.Operator, n int) error {
+	if fn, ok := operation.LookupFunction(string(op)); ok {
+		if !fn.AcceptsArgs(n) {
+			return fmt.Errorf("%s: wrong number of arguments: %d", fn.Name, n)
+		}
+		return nil
+	}
+
+	if op == operation.PackArray {
+		if n == 0 {
+			return fmt.Errorf("arrays can't be empty")
+		}
+		return nil
+	}
+
+	expected := 2
+	switch op {
+	case operation.Negation, operation.Not:
+		expected = 1
+	case operation.Conditional:
+		expected = 3
+	}
+	if n != expected {
+		return fmt.Errorf("operation %s expects %d operand(s), got %d", op, expected, n)
+	}
+	return nil
+}
+
+func formatOperand(operand operation.Operand) string {
+	if operand.Exact != "" {
+		return operand.Exact
+	}
+	return fmt.Sprintf("%f", operand.Value)
+}
+
+func calculateFloat(op operation.Operator, args []float64) (float64, error) {
+	if fn, ok := operation.LookupFunction(string(op)); ok {
+		return callFunction(fn, args)
+	}
+
+	if op == operation.Negation {
+		return -args[0], nil
+	}
+	left, right := args[0], args[1]
+
 	switch op {
 	case operation.Addition:
 		return left + right, nil
@@ -57,6 +146,29 @@ func Calculate(op operation.Operator, left, right float64, duration time.Duratio
 			return 0, fmt.Errorf("division by zero")
 		}
 		return left / right, nil
+	case operation.FloorDivision:
+		if right == 0 {
+			return 0, fmt.Errorf("division by zero")
+		}
+		return math.Floor(left / right), nil
+	case operation.Modulo:
+		if right == 0 {
+			return 0, fmt.Errorf("modulo by zero")
+		}
+		result := math.Mod(left, right)
+		if result != 0 && (result < 0) != (right < 0) {
+			result += right
+		}
+		return result, nil
+	case operation.Power:
+		if left == 0 && right < 0 {
+			return 0, fmt.Errorf("zero raised to a negative power")
+		}
+		result := math.Pow(left, right)
+		if math.IsNaN(result) && !math.IsNaN(left) && !math.IsNaN(right) {
+			return 0, fmt.Errorf("negative number raised to a non-integer power")
+		}
+		return result, nil
 	}
 	return 0, fmt.Errorf("unknown operation %s", op)
 }